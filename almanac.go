@@ -0,0 +1,195 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/YukariExpress/pgb/internal/lunar"
+)
+
+//go:embed data/almanac.yaml
+var almanacData []byte
+
+// officerNames are the twelve officers (建除十二神) in the order they are
+// counted.
+var officerNames = [12]string{"建", "除", "满", "平", "定", "执", "破", "危", "成", "收", "开", "闭"}
+
+// officer is one of the twelve officers governing the days of the almanac.
+//
+// Fields:
+//   - Name: The name of the officer, such as "建".
+//   - Yi: The activities favourable on its days (宜).
+//   - Ji: The activities unfavourable on its days (忌).
+type officer struct {
+	Name string   `yaml:"name"`
+	Yi   []string `yaml:"yi"`
+	Ji   []string `yaml:"ji"`
+}
+
+// parseOfficers parses and validates the rules of the almanac.
+//
+// Parameters:
+//   - data: The rules as YAML, a list of officers under the "officers" key.
+//
+// Returns:
+//   - The officers in the order they are counted.
+//   - An error if the data is malformed, the officers are not the twelve in
+//     order, or an officer has no activities, repeats one or lists one as
+//     both favourable and unfavourable.
+func parseOfficers(data []byte) ([]officer, error) {
+	var rules struct {
+		Officers []officer `yaml:"officers"`
+	}
+
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	if len(rules.Officers) != len(officerNames) {
+		return nil, fmt.Errorf("%d officers, want %d", len(rules.Officers), len(officerNames))
+	}
+
+	for i, o := range rules.Officers {
+		if o.Name != officerNames[i] {
+			return nil, fmt.Errorf("officer %d is %q, want %q", i+1, o.Name, officerNames[i])
+		}
+
+		if len(o.Yi) == 0 || len(o.Ji) == 0 {
+			return nil, fmt.Errorf("officer %s is missing favourable or unfavourable activities", o.Name)
+		}
+
+		seen := make(map[string]bool, len(o.Yi)+len(o.Ji))
+		for _, activity := range slices.Concat(o.Yi, o.Ji) {
+			if strings.TrimSpace(activity) == "" {
+				return nil, fmt.Errorf("officer %s has an empty activity", o.Name)
+			}
+
+			if seen[activity] {
+				return nil, fmt.Errorf("officer %s lists %s twice", o.Name, activity)
+			}
+
+			seen[activity] = true
+		}
+	}
+
+	return rules.Officers, nil
+}
+
+// officers are the embedded rules of the almanac.
+var officers = mustParse(parseOfficers, almanacData)
+
+// officerOf returns the officer governing a day. Counting starts at 建 on the
+// days sharing the branch of the solar month.
+//
+// Parameters:
+//   - month: The sexagenary term of the solar month.
+//   - day: The sexagenary term of the day.
+//
+// Returns:
+//   - The officer of the day.
+func officerOf(month, day lunar.GanZhi) officer {
+	return officers[(day.Branch()-month.Branch()+12)%12]
+}
+
+// chongOf returns the day a day clashes with (冲), whose branch is opposite
+// and whose stem is four further on, as almanacs print it.
+//
+// Parameters:
+//   - day: The sexagenary term of the day.
+//
+// Returns:
+//   - The term of the day clashed with.
+func chongOf(day lunar.GanZhi) lunar.GanZhi {
+	return lunar.NewGanZhi((day.Stem()+4)%10, (day.Branch()+6)%12)
+}
+
+// shaDirections are the directions of 煞 by the branch of the day, which
+// repeat every four branches: 申子辰 south, 巳酉丑 east, 寅午戌 north and
+// 亥卯未 west.
+var shaDirections = [4]string{"南", "东", "北", "西"}
+
+// weekdayNames are the Chinese names of the days of the week from Sunday.
+var weekdayNames = [7]string{"日", "一", "二", "三", "四", "五", "六"}
+
+// almanac shows the almanac of the date of an UpdateContext. The answer
+// depends on nothing but the date, so it does not repeat the query.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the time of the query.
+//
+// Returns:
+//   - A string with the date, the lunar date, the sexagenary terms of the
+//     year, month and day, the zodiac animal, the clash and 煞 of the day,
+//     its officer and its favourable and unfavourable activities, or a note
+//     if the date is outside the lunar calendar.
+func almanac(ctx *UpdateContext) string {
+	var b builder
+
+	t := ctx.Time
+	b.WriteStrings(t.Format("2006年1月2日"), " 星期", weekdayNames[t.Weekday()])
+
+	date, err := lunar.FromSolar(t)
+	if err != nil {
+		b.WriteStrings(" 不在农历范围内")
+
+		return b.String()
+	}
+
+	year, month, day := lunar.SolarYearGanZhi(t), lunar.MonthGanZhi(t), lunar.DayGanZhi(t)
+	chong := chongOf(day)
+	o := officerOf(month, day)
+
+	b.WriteStrings("\n农历: ", date.String(),
+		"\n干支: ", year.String(), "年 ", month.String(), "月 ", day.String(), "日",
+		"\n生肖: ", date.Zodiac(),
+		"\n冲煞: 冲", chong.Zodiac(), "(", chong.String(), ") 煞", shaDirections[day.Branch()%4],
+		"\n值日: ", o.Name, "日",
+		"\n宜: ", strings.Join(o.Yi, " "),
+		"\n忌: ", strings.Join(o.Ji, " "))
+
+	return b.String()
+}
+
+// almanacOracle shows the day's almanac (黄历) in the configured timezone.
+// Everyone gets the same almanac on the same day, so its inline result is
+// cached for everyone until midnight, and it reads the same in every
+// language.
+type almanacOracle struct{}
+
+func (almanacOracle) ID() string { return "almanac" }
+
+func (almanacOracle) Title(string) string { return "黄历" }
+
+func (almanacOracle) Description(string) string { return "今日干支、冲煞与宜忌" }
+
+func (almanacOracle) Consult(ctx *UpdateContext) string {
+	return almanac(ctx)
+}
+
+func (almanacOracle) Window() Window { return Window{unit: windowDay} }
+
+func (almanacOracle) Impersonal() {}
+
+func (almanacOracle) Keywords() []string {
+	return []string{"黄历", "老黄历", "宜忌", "almanac", "huangli"}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/YukariExpress/pgb/internal/lunar"
+)
+
+func TestParseOfficers(t *testing.T) {
+	parsed, err := parseOfficers(almanacData)
+	require.NoError(t, err)
+	require.Len(t, parsed, 12)
+	assert.Equal(t, "建", parsed[0].Name)
+	assert.Equal(t, "闭", parsed[11].Name)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "malformed", data: "officers: {"},
+		{name: "too few", data: "officers:\n  - {name: 建, yi: [出行], ji: [动土]}\n"},
+		{name: "out of order", data: officersYAML(func(i int) string {
+			return "{name: " + officerNames[(i+1)%12] + ", yi: [出行], ji: [动土]}"
+		})},
+		{name: "missing activities", data: officersYAML(func(i int) string {
+			return "{name: " + officerNames[i] + ", yi: [], ji: [动土]}"
+		})},
+		{name: "empty activity", data: officersYAML(func(i int) string {
+			return "{name: " + officerNames[i] + ", yi: [\" \"], ji: [动土]}"
+		})},
+		{name: "listed twice", data: officersYAML(func(i int) string {
+			return "{name: " + officerNames[i] + ", yi: [出行], ji: [出行]}"
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseOfficers([]byte(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// officersYAML formats rules with twelve officers given by entry.
+func officersYAML(entry func(i int) string) string {
+	var b builder
+	b.WriteStrings("officers:\n")
+	for i := range officerNames {
+		b.WriteStrings("  - ", entry(i), "\n")
+	}
+
+	return b.String()
+}
+
+func TestOfficerOf(t *testing.T) {
+	tests := []struct {
+		month, day lunar.GanZhi
+		want       string
+	}{
+		{month: lunar.NewGanZhi(2, 2), day: lunar.NewGanZhi(0, 2), want: "建"},
+		{month: lunar.NewGanZhi(2, 2), day: lunar.NewGanZhi(0, 4), want: "满"},
+		{month: lunar.NewGanZhi(2, 2), day: lunar.NewGanZhi(1, 1), want: "闭"},
+		{month: lunar.NewGanZhi(4, 10), day: lunar.NewGanZhi(9, 11), want: "除"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, officerOf(tt.month, tt.day).Name, "%v %v", tt.month, tt.day)
+	}
+}
+
+func TestChongOf(t *testing.T) {
+	assert.Equal(t, "戊午", chongOf(lunar.NewGanZhi(0, 0)).String())
+	assert.Equal(t, "戊戌", chongOf(lunar.NewGanZhi(0, 4)).String())
+	assert.Equal(t, "丁巳", chongOf(lunar.NewGanZhi(9, 11)).String())
+}
+
+func TestAlmanac(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{
+			name: "spring festival",
+			time: time.Date(2024, time.February, 10, 9, 0, 0, 0, shanghai),
+			want: "2024年2月10日 星期六\n农历: 甲辰年正月初一\n干支: 甲辰年 丙寅月 甲辰日\n生肖: 龙\n冲煞: 冲狗(戊戌) 煞南\n值日: 满日\n宜: 祈福 祭祀 开市 交易 立券 纳财\n忌: 栽种 安葬 上任 求医",
+		},
+		{
+			name: "autumn",
+			time: time.Date(2026, time.October, 16, 23, 59, 0, 0, shanghai),
+			want: "2026年10月16日 星期五\n农历: 丙午年九月初七\n干支: 丙午年 戊戌月 癸亥日\n生肖: 马\n冲煞: 冲蛇(丁巳) 煞西\n值日: 除日\n宜: 扫舍 沐浴 求医 祭祀 解除\n忌: 嫁娶 远行 搬迁 开市",
+		},
+		{
+			name: "out of range",
+			time: time.Date(2101, time.March, 1, 8, 0, 0, 0, shanghai),
+			want: "2101年3月1日 星期二 不在农历范围内",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, almanac(&UpdateContext{Time: tt.time}))
+		})
+	}
+}
+
+func TestAlmanacIsSameForEveryone(t *testing.T) {
+	s, err := newSettings(&Config{Timezone: "Asia/Shanghai"})
+	require.NoError(t, err)
+
+	s.oracles = []Oracle{almanacOracle{}}
+	now := time.Date(2024, time.February, 10, 1, 0, 0, 0, time.UTC)
+
+	a := consultOraclesAt(s, 1, "黄历", "zh", now)
+	b := consultOraclesAt(s, 2, "明天会下雨吗", "en", now)
+	require.Len(t, a, 1)
+	require.Len(t, b, 1)
+	assert.Equal(t, a[0].Text, b[0].Text)
+	assert.Contains(t, a[0].Text, "甲辰日")
+}
@@ -0,0 +1,202 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// choiceSeparators separate the options of a choice. "或", " or " and the
+// ASCII "/" and "|" are handled by choiceSeparatorAt, since they need more
+// care.
+var choiceSeparators = []string{"还是", "或者", "／", "｜"}
+
+// choiceResult separates the query from the chosen option in a choice.
+const choiceResult = "\n选择: "
+
+// choiceSeparatorAt returns the length of the separator starting at a byte
+// offset of a query, or 0 if there is none. "或" does not separate when it
+// starts "或许" (perhaps), "or" only separates as a whole word, and the ASCII
+// "/" and "|" only separate between whitespace or CJK characters, so that
+// "and/or" and URLs stay whole.
+//
+// Parameters:
+//   - s: The query.
+//   - i: The byte offset.
+//
+// Returns:
+//   - The length of the separator in bytes, or 0.
+func choiceSeparatorAt(s string, i int) int {
+	rest := s[i:]
+
+	for _, sep := range choiceSeparators {
+		if strings.HasPrefix(rest, sep) {
+			return len(sep)
+		}
+	}
+
+	if strings.HasPrefix(rest, "或") && !strings.HasPrefix(rest, "或许") {
+		return len("或")
+	}
+
+	if strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, "|") {
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(rest[1:])
+
+		if choiceBoundary(before) && choiceBoundary(after) {
+			return 1
+		}
+	}
+
+	if len(rest) >= 2 && strings.EqualFold(rest[:2], "or") {
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(rest[2:])
+
+		if unicode.IsSpace(before) && unicode.IsSpace(after) {
+			return 2
+		}
+	}
+
+	return 0
+}
+
+// choiceBoundary reports whether a rune next to an ASCII "/" or "|" lets it
+// separate options: whitespace, a CJK character, or the start or end of the
+// query, which utf8 decodes as utf8.RuneError.
+func choiceBoundary(r rune) bool {
+	return r == utf8.RuneError || unicode.IsSpace(r) ||
+		unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// parseChoices splits a query into the options it lists. Options are trimmed
+// of surrounding whitespace and punctuation, and empty or repeated options are
+// dropped.
+//
+// Parameters:
+//   - query: The query, such as "火锅还是烧烤" or "A / B / C".
+//
+// Returns:
+//   - The options in the order they are listed.
+func parseChoices(query string) []string {
+	var options []string
+	start := 0
+
+	add := func(option string) {
+		option = strings.TrimFunc(option, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsPunct(r)
+		})
+
+		if option != "" && !slices.Contains(options, option) {
+			options = append(options, option)
+		}
+	}
+
+	for i := 0; i < len(query); {
+		if n := choiceSeparatorAt(query, i); n > 0 {
+			add(query[start:i])
+			i += n
+			start = i
+
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(query[i:])
+		i += size
+	}
+
+	add(query[start:])
+
+	return options
+}
+
+// choose picks one of the options listed in the query of an UpdateContext.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the query and random
+//     number generator.
+//
+// Returns:
+//   - A string repeating the query and naming the chosen option.
+func choose(ctx *UpdateContext) string {
+	var b builder
+
+	options := parseChoices(*ctx.Query)
+	pick := options[ctx.Rand.Uint64()%uint64(len(options))]
+
+	b.WriteStrings("所求事项: ", *ctx.Query, choiceResult, pick)
+
+	return b.String()
+}
+
+// choiceOracle picks one of the options a query lists. It only answers
+// queries with two or more options.
+type choiceOracle struct{}
+
+func (choiceOracle) ID() string { return "choice" }
+
+func (choiceOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "帮我选"
+	}
+
+	return "Choose for me"
+}
+
+func (choiceOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "从列出的选项中选一个"
+	}
+
+	return "Pick one of the options"
+}
+
+func (choiceOracle) Accepts(query string) bool {
+	return len(parseChoices(query)) >= 2
+}
+
+func (choiceOracle) Consult(ctx *UpdateContext) string {
+	return choose(ctx)
+}
+
+// Expected gives every option of the query the same chance. Outcomes are
+// labelled by the position of the option and the number of options, such as
+// "2/3".
+func (choiceOracle) Expected(query string) []Outcome {
+	n := len(parseChoices(query))
+
+	outcomes := make([]Outcome, n)
+	for i := range outcomes {
+		outcomes[i] = Outcome{Label: fmt.Sprintf("%d/%d", i+1, n), P: 1 / float64(n)}
+	}
+
+	return outcomes
+}
+
+func (choiceOracle) Outcome(query, answer string) string {
+	options := parseChoices(query)
+
+	_, pick, _ := cutLast(answer, choiceResult)
+	if i := slices.Index(options, pick); i >= 0 {
+		return fmt.Sprintf("%d/%d", i+1, len(options))
+	}
+
+	return ""
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChoices(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"火锅还是烧烤", []string{"火锅", "烧烤"}},
+		{"火锅还是烧烤？", []string{"火锅", "烧烤"}},
+		{"去或者不去", []string{"去", "不去"}},
+		{"茶或咖啡", []string{"茶", "咖啡"}},
+		{"tea / coffee / juice", []string{"tea", "coffee", "juice"}},
+		{"tea | coffee", []string{"tea", "coffee"}},
+		{"火锅/烧烤", []string{"火锅", "烧烤"}},
+		{"火锅|烧烤 / pizza", []string{"火锅", "烧烤", "pizza"}},
+		{"tea|coffee", []string{"tea|coffee"}},
+		{"and/or", []string{"and/or"}},
+		{"cats and/or dogs", []string{"cats and/or dogs"}},
+		{"http://example.com/a|b", []string{"http://example.com/a|b"}},
+		{"http://example.com/a / http://example.com/b", []string{"http://example.com/a", "http://example.com/b"}},
+		{"tea／coffee｜juice", []string{"tea", "coffee", "juice"}},
+		{"tea or coffee?", []string{"tea", "coffee"}},
+		{"tea OR coffee", []string{"tea", "coffee"}},
+		{"tea or coffee or tea", []string{"tea", "coffee"}},
+		{"A / / B", []string{"A", "B"}},
+		{"orange or lemon", []string{"orange", "lemon"}},
+		{"Should I go to work", []string{"Should I go to work"}},
+		{"或许明天会下雨", []string{"或许明天会下雨"}},
+		{"color", []string{"color"}},
+		{"/", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseChoices(tt.query))
+		})
+	}
+}
+
+func TestChoiceAccepts(t *testing.T) {
+	o := choiceOracle{}
+
+	assert.True(t, o.Accepts("火锅还是烧烤"))
+	assert.True(t, o.Accepts("A / B / C"))
+	assert.True(t, o.Accepts("猫/狗"))
+	assert.False(t, o.Accepts("A/B/C"))
+	assert.False(t, o.Accepts("read docs at https://example.com/a/b"))
+	assert.False(t, o.Accepts("明天会下雨吗"))
+	assert.False(t, o.Accepts("A / A"))
+	assert.False(t, o.Accepts(""))
+}
+
+func TestChoose(t *testing.T) {
+	query := "A / B / C"
+	seen := map[string]bool{}
+
+	for seed := range int64(100) {
+		ctx := &UpdateContext{Query: &query, Rand: rand.New(rand.NewSource(seed))}
+
+		answer := choose(ctx)
+		assert.Contains(t, answer, "所求事项: A / B / C")
+
+		outcome := choiceOracle{}.Outcome(query, answer)
+		assert.Contains(t, []string{"1/3", "2/3", "3/3"}, outcome)
+		seen[outcome] = true
+	}
+
+	assert.Len(t, seen, 3)
+}
+
+func TestChoiceExpected(t *testing.T) {
+	outcomes := choiceOracle{}.Expected("火锅还是烧烤")
+
+	assert.Equal(t, []Outcome{{Label: "1/2", P: 0.5}, {Label: "2/2", P: 0.5}}, outcomes)
+	assert.Empty(t, choiceOracle{}.Outcome("火锅还是烧烤", "所求事项: 火锅还是烧烤\n选择: 面条"))
+}
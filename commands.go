@@ -0,0 +1,365 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+	"go.yaml.in/yaml/v3"
+)
+
+// command is a subcommand of the pgb binary.
+//
+// Fields:
+//   - Name: The name used to select the command on the command line.
+//   - Summary: A one-line description shown in the usage message.
+//   - Run: The function executing the command with the remaining arguments.
+type command struct {
+	Name    string
+	Summary string
+	Run     func(ctx context.Context, args []string) error
+}
+
+// defaultCommand is run when no subcommand is given.
+const defaultCommand = "serve"
+
+// commands lists the subcommands in the order they are shown in the usage
+// message. It is populated in init because the usage command refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			Name:    "serve",
+			Summary: "run the bot (default)",
+			Run:     serveCommand,
+		},
+		{
+			Name:    "healthcheck",
+			Summary: "probe the health endpoint of a local server",
+			Run:     healthcheckCommand,
+		},
+		{
+			Name:    "config",
+			Summary: "print the effective configuration (config print)",
+			Run:     configCommand,
+		},
+		{
+			Name:    "stats",
+			Summary: "check the outcome distributions of the oracles",
+			Run:     statsCommand,
+		},
+		{
+			Name:    "help",
+			Summary: "show this message",
+			Run:     helpCommand,
+		},
+	}
+}
+
+// runCommand selects the subcommand named by the first argument and runs it
+// with the remaining arguments. Without a subcommand, or when the first
+// argument is a flag, the default command is run.
+//
+// Parameters:
+//   - ctx: The context cancelled on SIGINT or SIGTERM.
+//   - args: The command line arguments without the program name.
+//
+// Returns:
+//   - An error if the command is unknown or failed.
+func runCommand(ctx context.Context, args []string) error {
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, c := range commands {
+		if c.Name == name {
+			return c.Run(ctx, args)
+		}
+	}
+
+	printUsage(os.Stderr)
+
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// printUsage writes the list of subcommands.
+//
+// Parameters:
+//   - w: The writer receiving the usage message.
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: pgb [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.Name, c.Summary)
+	}
+}
+
+// helpCommand prints the usage message to standard output.
+func helpCommand(_ context.Context, _ []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
+
+// newFlagSet creates a flag set for a subcommand that reports parse errors to
+// the caller instead of exiting.
+//
+// Parameters:
+//   - name: The name of the subcommand.
+//
+// Returns:
+//   - A pointer to a new flag.FlagSet.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("pgb "+name, flag.ContinueOnError)
+}
+
+// configFlag adds the -config flag naming the YAML configuration file to a
+// flag set.
+//
+// Parameters:
+//   - fs: The flag set of the subcommand.
+//
+// Returns:
+//   - A pointer to the flag value.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", "", "path of the YAML configuration `file`")
+}
+
+// serveCommand loads the configuration and runs the bot until the context is
+// cancelled. The configuration is reloaded on SIGHUP.
+func serveCommand(ctx context.Context, args []string) error {
+	fs := newFlagSet("serve")
+	path := configFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	load := func() (*Config, error) {
+		return loadConfig(ctx, *path, envconfig.OsLookuper())
+	}
+
+	conf, err := load()
+	if err != nil {
+		return err
+	}
+
+	if err := applySettings(conf); err != nil {
+		return err
+	}
+
+	go watchReload(ctx, hup, load, conf)
+
+	return run(ctx, conf)
+}
+
+// configCommand dispatches the config subcommands. The only one is print,
+// which writes the effective configuration, merged from the configuration
+// file, the environment and the defaults, as YAML with secrets redacted.
+func configCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: pgb config print [-config file]")
+	}
+
+	fs := newFlagSet("config print")
+	path := configFlag(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	conf, err := loadConfig(ctx, *path, envconfig.OsLookuper())
+	if err != nil {
+		return err
+	}
+
+	return printConfig(os.Stdout, conf)
+}
+
+// printConfig writes the configuration as YAML with secrets redacted.
+//
+// Parameters:
+//   - w: The writer receiving the YAML document.
+//   - conf: The configuration to print.
+//
+// Returns:
+//   - An error if encoding failed.
+func printConfig(w io.Writer, conf *Config) error {
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+
+	return enc.Encode(conf.Redacted())
+}
+
+// statsCommand simulates queries from many users over many time windows and
+// prints, for every oracle with a known distribution, the observed and
+// expected outcome frequencies with a chi-square goodness-of-fit test. With
+// -check it fails if any oracle deviates significantly, for use in CI.
+//
+// The configuration is read like that of serve, from the configuration file
+// and the environment, so that the oracles checked answer as the bot does.
+// Only the settings shaping answers are validated, so no token is needed.
+//
+// Parameters:
+//   - ctx: The context of the command.
+//   - args: The command line arguments after the command name.
+//
+// Returns:
+//   - An error if the configuration is invalid or, with -check, a deviation
+//     is significant.
+func statsCommand(ctx context.Context, args []string) error {
+	fs := newFlagSet("stats")
+	path := configFlag(fs)
+	samples := fs.Int("n", 100000, "number of simulated queries")
+	windows := fs.Int("windows", 48, "number of half-hour steps the queries are spread over")
+	alpha := fs.Float64("alpha", 0.001, "significance level of -check")
+	check := fs.Bool("check", false, "fail if a deviation is significant")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conf, err := readConfig(ctx, *path, envconfig.OsLookuper())
+	if err != nil {
+		return err
+	}
+
+	if err := conf.validateAnswers(); err != nil {
+		return err
+	}
+
+	s, err := newSettings(conf)
+	if err != nil {
+		return err
+	}
+
+	live.Store(s)
+
+	results := simulate(s, simulation{
+		Samples: *samples,
+		Windows: *windows,
+		Start:   statsStart,
+	})
+
+	if err := writeStats(os.Stdout, results); err != nil {
+		return err
+	}
+
+	if err := writeUnchecked(os.Stdout, uncheckedOracles(s)); err != nil {
+		return err
+	}
+
+	if *check {
+		return checkStats(results, *alpha)
+	}
+
+	return nil
+}
+
+// statsStart is the time of the first simulated window. It is fixed so that
+// runs are reproducible.
+var statsStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// probeConfig is the subset of Config needed to find the local server. It is
+// loaded separately so that probing does not require the bot token.
+type probeConfig struct {
+	Host string `env:"HOST, default=0.0.0.0"`
+	Port string `env:"PORT, default=8080"`
+}
+
+// healthcheckURL builds the URL of the local health endpoint. Wildcard
+// listen addresses are replaced by the loopback address.
+//
+// Parameters:
+//   - host: The host the server listens on.
+//   - port: The port the server listens on.
+//
+// Returns:
+//   - The URL of the health endpoint.
+func healthcheckURL(host, port string) string {
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, port),
+		Path:   healthzPath,
+	}
+
+	return u.String()
+}
+
+// healthcheckCommand probes the health endpoint of the server configured by
+// HOST and PORT, or the URL given with -url. It is meant for container health
+// checks in images without curl or wget and fails unless the endpoint answers
+// with 200 OK.
+func healthcheckCommand(ctx context.Context, args []string) error {
+	var probe probeConfig
+
+	if err := envconfig.Process(ctx, &probe); err != nil {
+		return err
+	}
+
+	fs := newFlagSet("healthcheck")
+	target := fs.String("url", healthcheckURL(probe.Host, probe.Port), "health endpoint to probe")
+	timeout := fs.Duration("timeout", 3*time.Second, "maximum duration of the probe")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("healthcheck: " + resp.Status)
+	}
+
+	return nil
+}
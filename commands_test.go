@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthcheckURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		port     string
+		expected string
+	}{
+		{name: "wildcard", host: "0.0.0.0", port: "8080", expected: "http://127.0.0.1:8080/healthz"},
+		{name: "empty host", host: "", port: "9000", expected: "http://127.0.0.1:9000/healthz"},
+		{name: "ipv6 wildcard", host: "::", port: "8080", expected: "http://[::1]:8080/healthz"},
+		{name: "explicit host", host: "10.0.0.2", port: "8080", expected: "http://10.0.0.2:8080/healthz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, healthcheckURL(tt.host, tt.port))
+		})
+	}
+}
+
+func TestHealthcheckCommand(t *testing.T) {
+	var st status
+	mux := http.NewServeMux()
+	st.Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	assert.NoError(t, runCommand(ctx, []string{"healthcheck", "-url", srv.URL + healthzPath}))
+	assert.Error(t, runCommand(ctx, []string{"healthcheck", "-url", srv.URL + readyzPath}))
+	assert.Error(t, runCommand(ctx, []string{"healthcheck", "-url", srv.URL + "/missing"}))
+}
+
+func TestRunCommandUnknown(t *testing.T) {
+	assert.Error(t, runCommand(context.Background(), []string{"divine"}))
+}
@@ -0,0 +1,520 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config represents the configuration settings for the application. Settings
+// are read from the environment and from an optional YAML configuration file
+// whose keys are the lowercased names of the environment variables.
+// Environment variables take precedence over the file. It includes the
+// following fields:
+//
+//   - Host: The hostname or IP address where the application will run. It is
+//     set via the "HOST" environment variable and defaults to "0.0.0.0".
+//   - Port: The port number on which the application will listen. It is set via
+//     the "PORT" environment variable and defaults to "8080".
+//   - Mode: How updates are received from Telegram, either "webhook" or
+//     "polling". It is set via the "MODE" environment variable and defaults to
+//     "webhook".
+//   - Token: A required authentication token for the application. It is set via
+//     the "TOKEN" environment variable, or read from the file named by the
+//     "TOKEN_FILE" environment variable, such as a Docker secret.
+//   - WebhookURL: The public HTTPS URL registered with Telegram on startup. It
+//     is set via the "WEBHOOK_URL" environment variable. Registration is
+//     skipped when it is empty.
+//   - WebhookSecret: The secret token Telegram sends with every webhook
+//     request. It is set via the "WEBHOOK_SECRET" environment variable, or read
+//     from the file named by the "WEBHOOK_SECRET_FILE" environment variable.
+//     Requests without a matching token are rejected when it is set.
+//   - WebhookDelete: Whether the webhook is deleted on shutdown. It is set via
+//     the "WEBHOOK_DELETE_ON_SHUTDOWN" environment variable and defaults to
+//     false.
+//   - WebhookCheckInterval: How often the registered webhook is compared
+//     against the configuration and repaired. It is set via the
+//     "WEBHOOK_CHECK_INTERVAL" environment variable and defaults to "10m". A
+//     zero interval disables the check.
+//   - ReadTimeout, WriteTimeout, IdleTimeout: The timeouts of the HTTP server.
+//     They are set via the "READ_TIMEOUT", "WRITE_TIMEOUT" and "IDLE_TIMEOUT"
+//     environment variables and default to "10s", "10s" and "60s".
+//   - LogLevel: The minimum level of log records, one of "debug", "info",
+//     "warn" or "error". It is set via the "LOG_LEVEL" environment variable and
+//     defaults to "info". Debug mode lowers it to "debug".
+//   - LogFormat: The log output format, either "json" or "text". It is set via
+//     the "LOG_FORMAT" environment variable and defaults to "json".
+//   - ShutdownTimeout: The grace period for in-flight requests and inline
+//     query answers on shutdown. It is set via the "SHUTDOWN_TIMEOUT"
+//     environment variable and defaults to "10s".
+//   - Oracles: The IDs of the enabled oracles in the order of their inline
+//     results. It is set via the "ORACLES" environment variable as a comma
+//     separated list and defaults to all oracles.
+//   - Titles: Result titles keyed by oracle and then by locale, overriding
+//     the built-in ones. The "default" locale applies to locales without a
+//     title of their own. It can only be set in the configuration file.
+//   - Tables: Outcome tables keyed by name ("omen" or "multiplier"),
+//     replacing the built-in ones. Each is a list of labels and integer
+//     weights. It can only be set in the configuration file.
+//   - LingqianFile: A YAML file holding the set of fortune sticks drawn by
+//     the lingqian oracle, replacing the built-in set. It is set via the
+//     "LINGQIAN_FILE" environment variable.
+//   - Window: The window during which a user gets the same answer to the same
+//     query, a duration or "day", "week" or "month". It is set via the
+//     "WINDOW" environment variable and defaults to "30m".
+//   - Windows: Windows keyed by oracle, overriding Window and the oracle's
+//     built-in window. It can only be set in the configuration file.
+//   - Timezone: The IANA timezone in which calendar windows start at
+//     midnight and time-based oracles read the clock. It is set via the
+//     "TIMEZONE" environment variable and defaults to "UTC".
+//   - SeedSecret: A server-side key that makes answers impossible to compute
+//     without it. It is set via the "SEED_SECRET" environment variable, or
+//     read from the file named by the "SEED_SECRET_FILE" environment
+//     variable. Setting, changing or removing it changes every answer.
+//   - SeedScheme: The version of the algorithm deriving answers from the
+//     user, window and query. It is set via the "SEED_SCHEME" environment
+//     variable and defaults to 1. Changing it changes every answer.
+//   - QueryNormalization: The normalization steps applied to queries before
+//     seeding by seed schemes that normalize queries, any of "nfkc",
+//     "whitespace", "punctuation" and "case". It is set via the
+//     "QUERY_NORMALIZATION" environment variable as a comma separated list
+//     and defaults to all of them.
+type Config struct {
+	Debug   bool          `env:"DEBUG, default=false" yaml:"debug"`
+	Host    string        `env:"HOST, default=0.0.0.0" yaml:"host"`
+	Mode    string        `env:"MODE, default=webhook" yaml:"mode"`
+	Port    string        `env:"PORT, default=8080" yaml:"port"`
+	Timeout time.Duration `env:"TIMEOUT, default=5s" yaml:"timeout"`
+	Token   string        `env:"TOKEN" yaml:"token"`
+
+	TokenFile         string `env:"TOKEN_FILE" yaml:"token_file"`
+	WebhookSecretFile string `env:"WEBHOOK_SECRET_FILE" yaml:"webhook_secret_file"`
+	SeedSecretFile    string `env:"SEED_SECRET_FILE" yaml:"seed_secret_file"`
+
+	LogLevel  string `env:"LOG_LEVEL, default=info" yaml:"log_level"`
+	LogFormat string `env:"LOG_FORMAT, default=json" yaml:"log_format"`
+
+	WebhookURL           string        `env:"WEBHOOK_URL" yaml:"webhook_url"`
+	WebhookSecret        string        `env:"WEBHOOK_SECRET" yaml:"webhook_secret"`
+	WebhookDelete        bool          `env:"WEBHOOK_DELETE_ON_SHUTDOWN, default=false" yaml:"webhook_delete_on_shutdown"`
+	WebhookCheckInterval time.Duration `env:"WEBHOOK_CHECK_INTERVAL, default=10m" yaml:"webhook_check_interval"`
+
+	ReadTimeout     time.Duration `env:"READ_TIMEOUT, default=10s" yaml:"read_timeout"`
+	WriteTimeout    time.Duration `env:"WRITE_TIMEOUT, default=10s" yaml:"write_timeout"`
+	IdleTimeout     time.Duration `env:"IDLE_TIMEOUT, default=60s" yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT, default=10s" yaml:"shutdown_timeout"`
+
+	Oracles []string                      `env:"ORACLES" yaml:"oracles,omitempty"`
+	Titles  map[string]map[string]string  `yaml:"titles,omitempty"`
+	Tables  map[string][]Weighted[string] `yaml:"tables,omitempty"`
+
+	LingqianFile string `env:"LINGQIAN_FILE" yaml:"lingqian_file"`
+
+	Window   Window            `env:"WINDOW, default=30m" yaml:"window"`
+	Windows  map[string]Window `yaml:"windows,omitempty"`
+	Timezone string            `env:"TIMEZONE, default=UTC" yaml:"timezone"`
+
+	SeedSecret string `env:"SEED_SECRET" yaml:"seed_secret"`
+	SeedScheme int    `env:"SEED_SCHEME, default=1" yaml:"seed_scheme"`
+
+	QueryNormalization []string `env:"QUERY_NORMALIZATION, default=nfkc,whitespace,punctuation,case" yaml:"query_normalization"`
+}
+
+// Run modes supported by Config.Mode.
+const (
+	ModeWebhook = "webhook"
+	ModePolling = "polling"
+)
+
+// Validate checks the configuration for missing and invalid values.
+//
+// Returns:
+//   - An error describing the first invalid setting, or nil if the
+//     configuration is valid.
+func (c *Config) Validate() error {
+	if c.Token == "" {
+		return errors.New("TOKEN or TOKEN_FILE is required")
+	}
+
+	switch c.Mode {
+	case ModeWebhook, ModePolling:
+	default:
+		return fmt.Errorf("invalid MODE %q: must be %q or %q", c.Mode, ModeWebhook, ModePolling)
+	}
+
+	if err := validateWebhookURL(c.WebhookURL); err != nil {
+		return err
+	}
+
+	if err := validateWebhookSecret(c.WebhookSecret); err != nil {
+		return err
+	}
+
+	if c.WebhookCheckInterval < 0 {
+		return fmt.Errorf("invalid WEBHOOK_CHECK_INTERVAL %s: must not be negative", c.WebhookCheckInterval)
+	}
+
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return err
+	}
+
+	switch c.LogFormat {
+	case LogFormatJSON, LogFormatText:
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q: must be %q or %q", c.LogFormat, LogFormatJSON, LogFormatText)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid SHUTDOWN_TIMEOUT %s: must be positive", c.ShutdownTimeout)
+	}
+
+	return c.validateAnswers()
+}
+
+// validateAnswers checks the settings that shape the answers of the oracles,
+// which pgb stats checks without requiring a token.
+//
+// Returns:
+//   - An error describing the first invalid setting, or nil if the settings
+//     are valid.
+func (c *Config) validateAnswers() error {
+	if _, err := oracles.Select(c.Oracles); err != nil {
+		return fmt.Errorf("invalid ORACLES: %w", err)
+	}
+
+	if err := validateTitles(c.Titles); err != nil {
+		return err
+	}
+
+	if _, err := newTables(c.Tables); err != nil {
+		return err
+	}
+
+	if c.LingqianFile != "" {
+		if _, err := loadLingqianSet(c.LingqianFile); err != nil {
+			return err
+		}
+	}
+
+	if err := validateWindows(c.Windows); err != nil {
+		return err
+	}
+
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid TIMEZONE %q: %w", c.Timezone, err)
+	}
+
+	if c.SeedSecret != "" && len(c.SeedSecret) < minSeedSecretLen {
+		return fmt.Errorf("invalid SEED_SECRET: must be at least %d bytes", minSeedSecretLen)
+	}
+
+	if _, err := getSeedScheme(c.SeedScheme); err != nil {
+		return fmt.Errorf("invalid SEED_SCHEME: %w", err)
+	}
+
+	if _, err := newQueryNormalizer(c.QueryNormalization); err != nil {
+		return fmt.Errorf("invalid QUERY_NORMALIZATION: %w", err)
+	}
+
+	return nil
+}
+
+// readSecretFile reads a secret from a file, such as a mounted Docker or
+// Kubernetes secret, and trims surrounding whitespace.
+//
+// Parameters:
+//   - name: The name of the setting, used in error messages.
+//   - path: The path of the file.
+//
+// Returns:
+//   - The secret.
+//   - An error if the file cannot be read or contains only whitespace.
+func readSecretFile(name, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s %s is empty", name, path)
+	}
+
+	return secret, nil
+}
+
+// resolveSecret fills a secret from its file if the file is configured. It is
+// an error to set both the secret and its file.
+//
+// Parameters:
+//   - name: The name of the secret setting, used in error messages.
+//   - secret: The secret, updated in place.
+//   - path: The path of the secret file, possibly empty.
+//
+// Returns:
+//   - An error if both forms are set or the file cannot be used.
+func resolveSecret(name string, secret *string, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if *secret != "" {
+		return fmt.Errorf("%s and %s_FILE are mutually exclusive", name, name)
+	}
+
+	s, err := readSecretFile(name+"_FILE", path)
+	if err != nil {
+		return err
+	}
+
+	*secret = s
+
+	return nil
+}
+
+// ResolveSecrets reads the token, the webhook secret and the seed secret from
+// their files when TOKEN_FILE, WEBHOOK_SECRET_FILE or SEED_SECRET_FILE is set.
+//
+// Returns:
+//   - An error if a secret is set both directly and by file, or a file cannot
+//     be used.
+func (c *Config) ResolveSecrets() error {
+	if err := resolveSecret("TOKEN", &c.Token, c.TokenFile); err != nil {
+		return err
+	}
+
+	if err := resolveSecret("WEBHOOK_SECRET", &c.WebhookSecret, c.WebhookSecretFile); err != nil {
+		return err
+	}
+
+	return resolveSecret("SEED_SECRET", &c.SeedSecret, c.SeedSecretFile)
+}
+
+// redacted replaces a secret with a placeholder, keeping empty values empty so
+// that it remains visible whether the secret is set.
+//
+// Parameters:
+//   - secret: The secret to hide.
+//
+// Returns:
+//   - "REDACTED" if the secret is set, or an empty string otherwise.
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return "REDACTED"
+}
+
+// Redacted returns a copy of the configuration with all secrets replaced by a
+// placeholder, suitable for printing.
+//
+// Returns:
+//   - The redacted copy.
+func (c Config) Redacted() Config {
+	c.Token = redacted(c.Token)
+	c.WebhookSecret = redacted(c.WebhookSecret)
+	c.SeedSecret = redacted(c.SeedSecret)
+
+	return c
+}
+
+// decodeConfigFile decodes a YAML configuration file. Unknown keys and values
+// of the wrong type, such as malformed durations, are rejected.
+//
+// Parameters:
+//   - data: The content of the configuration file.
+//
+// Returns:
+//   - A pointer to the decoded configuration.
+//   - The set of top-level keys present in the file.
+//   - An error describing the offending lines, or nil on success.
+func decodeConfigFile(data []byte) (*Config, map[string]bool, error) {
+	var conf Config
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&conf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return &conf, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[string]bool, len(raw))
+	for k := range raw {
+		keys[k] = true
+	}
+
+	return &conf, keys, nil
+}
+
+// nonEmptyLookuper hides environment variables set to the empty string, so
+// that a line such as "WINDOW=" in a compose file counts as unset instead of
+// replacing the value of the configuration file.
+type nonEmptyLookuper struct {
+	envconfig.Lookuper
+}
+
+func (l nonEmptyLookuper) Lookup(key string) (string, bool) {
+	v, ok := l.Lookuper.Lookup(key)
+	return v, ok && v != ""
+}
+
+// secretPairs maps the environment variable of each secret to that of its
+// file and back. The environment takes precedence over the configuration
+// file for a pair as a whole, so that TOKEN_FILE in the environment is not
+// combined with a token in the file.
+var secretPairs = map[string]string{
+	"TOKEN":               "TOKEN_FILE",
+	"TOKEN_FILE":          "TOKEN",
+	"WEBHOOK_SECRET":      "WEBHOOK_SECRET_FILE",
+	"WEBHOOK_SECRET_FILE": "WEBHOOK_SECRET",
+	"SEED_SECRET":         "SEED_SECRET_FILE",
+	"SEED_SECRET_FILE":    "SEED_SECRET",
+}
+
+// mergeConfigFile copies the values set in the configuration file into the
+// configuration read from the environment, except for those whose environment
+// variable is set, or for secrets, whose own variable or that of the other
+// member of their pair is set. Keys absent from the file keep their
+// environment or default value, while keys present in the file are copied
+// even if their value is the zero value.
+//
+// Parameters:
+//   - dst: The configuration read from the environment.
+//   - file: The configuration decoded from the file.
+//   - keys: The set of keys present in the file.
+//   - env: The source of environment variables.
+func mergeConfigFile(dst, file *Config, keys map[string]bool, env envconfig.Lookuper) {
+	dv := reflect.ValueOf(dst).Elem()
+	fv := reflect.ValueOf(file).Elem()
+	t := dv.Type()
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if !keys[key] {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if _, ok := env.Lookup(name); ok && name != "" {
+			continue
+		}
+
+		if pair, ok := secretPairs[name]; ok {
+			if _, ok := env.Lookup(pair); ok {
+				continue
+			}
+		}
+
+		dv.Field(i).Set(fv.Field(i))
+	}
+}
+
+// loadConfig builds the effective configuration with readConfig and validates
+// it.
+//
+// Parameters:
+//   - ctx: The context for envconfig processing.
+//   - path: The path of the YAML configuration file, or empty for none.
+//   - env: The source of environment variables.
+//
+// Returns:
+//   - A pointer to the effective configuration.
+//   - An error if the file cannot be read or decoded, or the result is
+//     invalid.
+func loadConfig(ctx context.Context, path string, env envconfig.Lookuper) (*Config, error) {
+	conf, err := readConfig(ctx, path, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// readConfig builds the effective configuration. Environment variables take
+// precedence over the configuration file, if any, and defaults fill in
+// whatever neither sets. Environment variables set to the empty string count
+// as unset. Secrets are then read from their files. The result is not
+// validated.
+//
+// Parameters:
+//   - ctx: The context for envconfig processing.
+//   - path: The path of the YAML configuration file, or empty for none.
+//   - env: The source of environment variables.
+//
+// Returns:
+//   - A pointer to the configuration.
+//   - An error if the file cannot be read or decoded, or a secret file cannot
+//     be used.
+func readConfig(ctx context.Context, path string, env envconfig.Lookuper) (*Config, error) {
+	var conf Config
+
+	env = nonEmptyLookuper{env}
+
+	err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target:   &conf,
+		Lookuper: env,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+
+		file, keys, err := decodeConfigFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+
+		mergeConfigFile(&conf, file, keys, env)
+	}
+
+	if err := conf.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	return &conf, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConfig returns a configuration with all defaults applied and a dummy
+// token.
+func testConfig(t *testing.T) Config {
+	t.Helper()
+
+	var conf Config
+	err := envconfig.ProcessWith(context.Background(), &envconfig.Config{
+		Target:   &conf,
+		Lookuper: envconfig.MapLookuper(map[string]string{"TOKEN": "123:abc"}),
+	})
+	assert.NoError(t, err)
+
+	return conf
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		wantErr bool
+	}{
+		{name: "webhook", mode: ModeWebhook},
+		{name: "polling", mode: ModePolling},
+		{name: "empty", mode: "", wantErr: true},
+		{name: "unknown", mode: "push", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testConfig(t)
+			conf.Mode = tt.mode
+			err := conf.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// writeConfigFile writes a configuration file into a temporary directory.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pgb.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+mode: polling
+port: "9000"
+timeout: 7s
+token: "123:file"
+webhook_check_interval: 0s
+`)
+	env := envconfig.MapLookuper(map[string]string{
+		"PORT":  "9100",
+		"TOKEN": "123:env",
+	})
+
+	conf, err := loadConfig(context.Background(), path, env)
+	assert.NoError(t, err)
+
+	// Environment overrides the file.
+	assert.Equal(t, "9100", conf.Port)
+	assert.Equal(t, "123:env", conf.Token)
+	// File overrides defaults, including zero values.
+	assert.Equal(t, ModePolling, conf.Mode)
+	assert.Equal(t, 7*time.Second, conf.Timeout)
+	assert.Equal(t, time.Duration(0), conf.WebhookCheckInterval)
+	// Defaults fill in the rest.
+	assert.Equal(t, "0.0.0.0", conf.Host)
+	assert.Equal(t, 10*time.Second, conf.ShutdownTimeout)
+}
+
+func TestLoadConfigEmptyEnv(t *testing.T) {
+	path := writeConfigFile(t, `
+window: 1h
+oracles: [pia]
+`)
+	env := envconfig.MapLookuper(map[string]string{
+		"TOKEN":   "123:env",
+		"WINDOW":  "",
+		"ORACLES": "",
+	})
+
+	conf, err := loadConfig(context.Background(), path, env)
+	assert.NoError(t, err)
+	assert.Equal(t, Window{d: time.Hour}, conf.Window)
+	assert.Equal(t, []string{"pia"}, conf.Oracles)
+}
+
+func TestLoadConfigSecretPairPrecedence(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenPath, []byte("123:secret\n"), 0o600))
+
+	path := writeConfigFile(t, `
+token: "123:file"
+`)
+	env := envconfig.MapLookuper(map[string]string{"TOKEN_FILE": tokenPath})
+
+	conf, err := loadConfig(context.Background(), path, env)
+	assert.NoError(t, err)
+	assert.Equal(t, "123:secret", conf.Token)
+}
+
+func TestLoadConfigTables(t *testing.T) {
+	path := writeConfigFile(t, `
+tables:
+  omen:
+    - {label: 凶, weight: 1}
+    - {label: "", weight: 2}
+    - {label: 吉, weight: 1}
+`)
+	env := envconfig.MapLookuper(map[string]string{"TOKEN": "123:env"})
+
+	conf, err := loadConfig(context.Background(), path, env)
+	assert.NoError(t, err)
+	assert.Equal(t, []Weighted[string]{
+		{Label: "凶", Weight: 1},
+		{Label: "", Weight: 2},
+		{Label: "吉", Weight: 1},
+	}, conf.Tables[tableOmen])
+}
+
+func TestLoadConfigWindows(t *testing.T) {
+	path := writeConfigFile(t, `
+window: 1h
+windows:
+  divine: day
+timezone: Asia/Shanghai
+`)
+	env := envconfig.MapLookuper(map[string]string{"TOKEN": "123:env", "WINDOW": "week"})
+
+	conf, err := loadConfig(context.Background(), path, env)
+	assert.NoError(t, err)
+	assert.Equal(t, Window{unit: windowWeek}, conf.Window)
+	assert.Equal(t, map[string]Window{"divine": {unit: windowDay}}, conf.Windows)
+	assert.Equal(t, "Asia/Shanghai", conf.Timezone)
+
+	var buf bytes.Buffer
+	assert.NoError(t, printConfig(&buf, conf))
+	assert.Contains(t, buf.String(), "window: week\n")
+	assert.Contains(t, buf.String(), "divine: day\n")
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	env := envconfig.MapLookuper(map[string]string{"TOKEN": "123:env"})
+
+	conf, err := loadConfig(context.Background(), "", env)
+	assert.NoError(t, err)
+	assert.Equal(t, "123:env", conf.Token)
+	assert.Equal(t, ModeWebhook, conf.Mode)
+	assert.Equal(t, defaultSeedScheme, conf.SeedScheme)
+	assert.Equal(t, normalizeSteps, conf.QueryNormalization)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	env := envconfig.MapLookuper(map[string]string{"TOKEN": "123:env"})
+
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{name: "unknown key", content: "colour: red\n", message: "field colour not found"},
+		{name: "bad duration", content: "timeout: soon\n", message: "time.Duration"},
+		{name: "integer duration", content: "timeout: 5\n", message: "time.Duration"},
+		{name: "invalid value", content: "mode: push\n", message: "invalid MODE"},
+		{name: "malformed", content: "mode: [\n", message: "yaml"},
+		{name: "unknown table", content: "tables:\n  luck: [{label: a, weight: 1}]\n", message: "unknown table"},
+		{name: "zero table", content: "tables:\n  omen: [{label: a, weight: 0}]\n", message: "sum to zero"},
+		{name: "duplicate label", content: "tables:\n  omen: [{label: a, weight: 1}, {label: a, weight: 1}]\n", message: "listed twice"},
+		{name: "bad window", content: "window: fortnight\n", message: "line 1: window"},
+		{name: "bad oracle window", content: "mode: polling\nwindows:\n  tarot: soon\n", message: "line 3: window \"soon\""},
+		{name: "unknown window oracle", content: "windows:\n  nonexistent: day\n", message: "unknown oracle"},
+		{name: "bad timezone", content: "timezone: Mars/Olympus_Mons\n", message: "invalid TIMEZONE"},
+		{name: "unknown seed scheme", content: "seed_scheme: 99\n", message: "invalid SEED_SCHEME"},
+		{name: "unknown normalization", content: "query_normalization: [nfc]\n", message: "invalid QUERY_NORMALIZATION"},
+		{name: "short seed secret", content: "seed_secret: short\n", message: "invalid SEED_SECRET"},
+		{name: "negative weight", content: "tables:\n  omen: [{label: a, weight: -1}]\n", message: "uint32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(context.Background(), writeConfigFile(t, tt.content), env)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.message)
+			}
+		})
+	}
+
+	_, err := loadConfig(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"), env)
+	assert.Error(t, err)
+}
+
+func TestLoadConfigEmptyFile(t *testing.T) {
+	env := envconfig.MapLookuper(map[string]string{"TOKEN": "123:env"})
+
+	conf, err := loadConfig(context.Background(), writeConfigFile(t, ""), env)
+	assert.NoError(t, err)
+	assert.Equal(t, "8080", conf.Port)
+}
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	conf := testConfig(t)
+	conf.WebhookSecret = "s3cret"
+	conf.SeedSecret = "0123456789abcdef"
+
+	var out strings.Builder
+	assert.NoError(t, printConfig(&out, &conf))
+	assert.NotContains(t, out.String(), "123:abc")
+	assert.NotContains(t, out.String(), "s3cret")
+	assert.NotContains(t, out.String(), "0123456789abcdef")
+	assert.Contains(t, out.String(), "token: REDACTED")
+	assert.Contains(t, out.String(), "shutdown_timeout: 10s")
+
+	// The original configuration is left untouched.
+	assert.Equal(t, "123:abc", conf.Token)
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	secretPath := filepath.Join(dir, "secret")
+	emptyPath := filepath.Join(dir, "empty")
+	assert.NoError(t, os.WriteFile(tokenPath, []byte("  123:file\n"), 0o600))
+	seedPath := filepath.Join(dir, "seed")
+	assert.NoError(t, os.WriteFile(secretPath, []byte("hook-secret\n"), 0o600))
+	assert.NoError(t, os.WriteFile(seedPath, []byte("0123456789abcdef\n"), 0o600))
+	assert.NoError(t, os.WriteFile(emptyPath, []byte(" \n"), 0o600))
+
+	conf, err := loadConfig(context.Background(), "", envconfig.MapLookuper(map[string]string{
+		"TOKEN_FILE":          tokenPath,
+		"WEBHOOK_SECRET_FILE": secretPath,
+		"SEED_SECRET_FILE":    seedPath,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "123:file", conf.Token)
+	assert.Equal(t, "hook-secret", conf.WebhookSecret)
+	assert.Equal(t, "0123456789abcdef", conf.SeedSecret)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		message string
+	}{
+		{
+			name:    "neither",
+			env:     map[string]string{},
+			message: "TOKEN or TOKEN_FILE is required",
+		},
+		{
+			name:    "both tokens",
+			env:     map[string]string{"TOKEN": "123:env", "TOKEN_FILE": tokenPath},
+			message: "mutually exclusive",
+		},
+		{
+			name:    "both webhook secrets",
+			env:     map[string]string{"TOKEN": "123:env", "WEBHOOK_SECRET": "x", "WEBHOOK_SECRET_FILE": secretPath},
+			message: "mutually exclusive",
+		},
+		{
+			name:    "both seed secrets",
+			env:     map[string]string{"TOKEN": "123:env", "SEED_SECRET": "0123456789abcdef", "SEED_SECRET_FILE": seedPath},
+			message: "mutually exclusive",
+		},
+		{
+			name:    "empty file",
+			env:     map[string]string{"TOKEN_FILE": emptyPath},
+			message: "is empty",
+		},
+		{
+			name:    "missing file",
+			env:     map[string]string{"TOKEN_FILE": filepath.Join(dir, "missing")},
+			message: "read TOKEN_FILE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(context.Background(), "", envconfig.MapLookuper(tt.env))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+// localizedText is a text in every locale pgb answers in.
+//
+// Fields:
+//   - Zh: The Chinese text.
+//   - En: The English text, used for every other locale.
+type localizedText struct {
+	Zh string `yaml:"zh"`
+	En string `yaml:"en"`
+}
+
+// In returns the text in a locale.
+//
+// Parameters:
+//   - locale: The locale, such as "zh" or "en".
+//
+// Returns:
+//   - The Chinese text for "zh" and the English text otherwise.
+func (t localizedText) In(locale string) string {
+	if locale == "zh" {
+		return t.Zh
+	}
+
+	return t.En
+}
+
+// isComplete reports whether the text is given in every locale.
+func (t localizedText) isComplete() bool {
+	return t.Zh != "" && t.En != ""
+}
+
+// mustParse parses embedded data and panics if that fails. The data is built
+// into the binary and parsed by the tests, so an error is a programming error
+// rather than something to report at runtime.
+//
+// Parameters:
+//   - parse: The function parsing and validating the data.
+//   - data: The embedded data.
+//
+// Returns:
+//   - The parsed value.
+func mustParse[T any](parse func([]byte) (T, error), data []byte) T {
+	v, err := parse(data)
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
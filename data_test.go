@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMustParse(t *testing.T) {
+	parse := func(data []byte) (int, error) {
+		if len(data) == 0 {
+			return 0, errors.New("empty")
+		}
+
+		return len(data), nil
+	}
+
+	assert.Equal(t, 3, mustParse(parse, []byte("abc")))
+	assert.PanicsWithError(t, "empty", func() { mustParse(parse, nil) })
+}
@@ -0,0 +1,165 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/YukariExpress/pgb/internal/dice"
+)
+
+// diceTotal separates the rolls from the total in a dice roll.
+const diceTotal = "\n总计: "
+
+// formatDie formats a rolled die, marking exploded dice with "!" and putting
+// dropped dice in parentheses.
+//
+// Parameters:
+//   - d: The die.
+//
+// Returns:
+//   - The formatted die, such as "6", "10!" or "(1)".
+func formatDie(d dice.Die) string {
+	s := strconv.Itoa(d.Value)
+
+	if d.Exploded {
+		s += "!"
+	}
+
+	if d.Dropped {
+		s = "(" + s + ")"
+	}
+
+	return s
+}
+
+// roll rolls the dice expression in the query of an UpdateContext.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the query and random
+//     number generator.
+//
+// Returns:
+//   - A string with the expression, every die rolled and the total, or an
+//     empty string if the query is not a dice expression.
+func roll(ctx *UpdateContext) string {
+	var b builder
+
+	e, err := dice.Parse(*ctx.Query)
+	if err != nil {
+		return ""
+	}
+
+	res := e.Roll(ctx.Rand)
+
+	b.WriteStrings("掷骰: ", e.String())
+
+	for _, tr := range res.Terms {
+		if !tr.Term.IsDice() {
+			continue
+		}
+
+		b.WriteStrings("\n", tr.Term.String(), ": ")
+
+		for i, d := range tr.Dice {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+
+			b.WriteString(formatDie(d))
+		}
+	}
+
+	b.WriteStrings(diceTotal, strconv.Itoa(res.Total))
+
+	return b.String()
+}
+
+// diceOracle rolls tabletop dice written in dice notation, such as "2d6+3",
+// "4d6kh3" or "3d10!". It only answers queries that are dice expressions.
+type diceOracle struct{}
+
+func (diceOracle) ID() string { return "dice" }
+
+func (diceOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "掷骰"
+	}
+
+	return "Roll dice"
+}
+
+func (diceOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "掷出骰子，如 2d6+3"
+	}
+
+	return "Roll dice such as 2d6+3"
+}
+
+func (diceOracle) Accepts(query string) bool {
+	_, err := dice.Parse(query)
+	return err == nil
+}
+
+func (diceOracle) Consult(ctx *UpdateContext) string {
+	return roll(ctx)
+}
+
+// firstDiceTerm returns the first term of an expression that rolls dice.
+// Parse ensures there is one.
+func firstDiceTerm(e dice.Expr) dice.Term {
+	for _, t := range e.Terms {
+		if t.IsDice() {
+			return t
+		}
+	}
+
+	return dice.Term{}
+}
+
+// Expected returns the chances of the first die rolled for a query, whose
+// side is uniform whatever the rest of the expression does: keeping dice
+// only marks it dropped, and exploding only rolls more dice after it. The
+// outcomes are labelled by the side, such as "6".
+func (diceOracle) Expected(query string) []Outcome {
+	e, err := dice.Parse(query)
+	if err != nil {
+		return nil
+	}
+
+	sides := firstDiceTerm(e).Sides
+
+	outcomes := make([]Outcome, sides)
+	for i := range outcomes {
+		outcomes[i] = Outcome{Label: strconv.Itoa(i + 1), P: 1 / float64(sides)}
+	}
+
+	return outcomes
+}
+
+func (diceOracle) Outcome(_, answer string) string {
+	// The first die follows the first term on the second line, as in
+	// "2d6: (1), 5".
+	_, rolls, _ := strings.Cut(answer, "\n")
+	_, rolls, _ = strings.Cut(rolls, ": ")
+	first, _, _ := strings.Cut(rolls, ", ")
+	first, _, _ = strings.Cut(first, "\n")
+
+	return strings.Trim(first, "()!")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/YukariExpress/pgb/internal/dice"
+)
+
+func TestDiceAccepts(t *testing.T) {
+	o := diceOracle{}
+
+	assert.True(t, o.Accepts("2d6+3"))
+	assert.True(t, o.Accepts(" D20 "))
+	assert.False(t, o.Accepts("明天会下雨吗"))
+	assert.False(t, o.Accepts("42"))
+	assert.False(t, o.Accepts("1000d6"))
+}
+
+func TestFormatDie(t *testing.T) {
+	assert.Equal(t, "6", formatDie(dice.Die{Value: 6}))
+	assert.Equal(t, "10!", formatDie(dice.Die{Value: 10, Exploded: true}))
+	assert.Equal(t, "(1)", formatDie(dice.Die{Value: 1, Dropped: true}))
+}
+
+func TestRollAnswer(t *testing.T) {
+	query := "2d1 + 3"
+	ctx := &UpdateContext{Query: &query, Rand: rand.New(rand.NewSource(1))}
+
+	assert.Equal(t, "掷骰: 2d1+3\n2d1: 1, 1\n总计: 5", roll(ctx))
+
+	query = "明天会下雨吗"
+	assert.Empty(t, roll(ctx))
+}
+
+func TestRollAnswerIsDeterministic(t *testing.T) {
+	seed := Seed{UserID: 42, Window: statsStart, Query: "4d6kh3+3d10!"}
+
+	for _, scheme := range []SeedScheme{seedSchemeV1{}, seedSchemeV2{}} {
+		want := roll(buildUpdateContextAt(scheme, seed, "zh"))
+
+		assert.Contains(t, want, "\n4d6kh3: ")
+		assert.Contains(t, want, "\n3d10!: ")
+		assert.Equal(t, want, roll(buildUpdateContextAt(scheme, seed, "zh")))
+	}
+}
+
+func TestDiceOutcome(t *testing.T) {
+	o := diceOracle{}
+
+	expected := o.Expected("-2 + 3d8!kl2")
+	require.Len(t, expected, 8)
+	assert.Equal(t, "1", expected[0].Label)
+	assert.Equal(t, "8", expected[7].Label)
+	assert.InDelta(t, 0.125, expected[0].P, 1e-12)
+	assert.Nil(t, o.Expected("not dice"))
+
+	for _, tt := range []struct{ answer, want string }{
+		{"掷骰: 2d6+3\n2d6: 4, 2\n总计: 9", "4"},
+		{"掷骰: 4d6kh3\n4d6kh3: (1), 5, 3, 6\n总计: 14", "1"},
+		{"掷骰: 3d10!\n3d10!: 10!, 2, 7, 1\n总计: 20", "10"},
+		{"掷骰: d20\nd20: 17\n总计: 17", "17"},
+	} {
+		assert.Equal(t, tt.want, o.Outcome("", tt.answer), tt.answer)
+	}
+}
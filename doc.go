@@ -22,7 +22,191 @@ run behind a reverse proxy that handes HTTPS termination.
 This program expects the following environment variables:
 	- HOST: The hostname or IP address where pgb binds to (default: "0.0.0.0").
 	- PORT: The port on which pgb listens (default: "8080").
+	- MODE: How updates are received, "webhook" or "polling" (default:
+	  "webhook"). Polling needs no public HTTPS endpoint and is handy for local
+	  development.
 	- TOKEN: The Telegram bot authentication token (required).
+	- TOKEN_FILE: A file to read the token from instead, such as a Docker
+	  secret. Exactly one of TOKEN and TOKEN_FILE must be set.
+	- WEBHOOK_URL: The public HTTPS URL registered with Telegram on startup.
+	- WEBHOOK_SECRET: The secret token Telegram must send with every webhook
+	  request; requests without it are rejected.
+	- WEBHOOK_SECRET_FILE: A file to read the webhook secret from instead.
+	- WEBHOOK_DELETE_ON_SHUTDOWN: Delete the webhook on shutdown (default:
+	  "false").
+	- WEBHOOK_CHECK_INTERVAL: How often the registered webhook is checked and
+	  repaired, "0" disables the check (default: "10m").
+	- READ_TIMEOUT, WRITE_TIMEOUT, IDLE_TIMEOUT: The HTTP server timeouts
+	  (default: "10s", "10s", "60s").
+	- LOG_LEVEL: The minimum log level, "debug", "info", "warn" or "error"
+	  (default: "info").
+	- LOG_FORMAT: The log output format, "json" or "text" (default: "json").
+	- DEBUG: Log every Telegram API request and response at debug level
+	  (default: "false").
+	- SHUTDOWN_TIMEOUT: The grace period for in-flight requests after SIGINT or
+	  SIGTERM (default: "10s").
+	- SEED_SECRET: A secret of at least 16 bytes keying the answers, so that
+	  they cannot be computed in advance from the source code. Setting,
+	  changing or removing it changes every answer. It also keys the
+	  pseudonyms of user IDs in the logs; without it they are keyed randomly
+	  and only stay the same until a restart.
+	- SEED_SECRET_FILE: A file to read the seed secret from instead.
+	- SEED_SCHEME: The version of the algorithm deriving answers, see below
+	  (default: "1").
+	- QUERY_NORMALIZATION: The steps normalizing queries before seeding under
+	  seed scheme 3, any of "nfkc", "whitespace", "punctuation" and "case"
+	  (default: all of them).
+	- WINDOW: How long a user gets the same answer to the same query, a
+	  duration such as "1h" or a calendar "day", "week" or "month" (default:
+	  "30m").
+	- TIMEZONE: The IANA timezone whose midnight starts calendar windows and
+	  the day of the almanac, and whose clock the xiaoliuren oracle reads,
+	  such as "Asia/Shanghai" (default: "UTC").
+	- LINGQIAN_FILE: A YAML file with the set of fortune sticks of the
+	  lingqian oracle, replacing the built-in set (see below).
+	- ORACLES: A comma separated list of the oracles to offer, in the order
+	  their results are shown, such as "pia,divine" (default: every registered
+	  oracle). Reordering or disabling oracles leaves the answers of the
+	  others as they were.
+
+Settings can also be kept in a YAML file passed with -config. Its keys are the
+lowercased environment variable names, and environment variables take
+precedence over the file, except those set to the empty string, which count as
+unset. A secret or its file set in the environment replaces both in the file:
+	mode: polling
+	log_format: text
+	shutdown_timeout: 30s
+	oracles: [divine, pia]
+	titles:
+	  divine:
+	    zh: 求签
+	    default: Divination
+
+The chances of the divination outcomes come from two weighted tables, "omen"
+and "multiplier", which the configuration file can replace. Each entry is a
+label and an integer weight; the empty omen stands for "尚可" and the empty
+multiplier for none. The built-in omen table is equivalent to:
+	tables:
+	  omen:
+	    - {label: 凶, weight: 7}
+	    - {label: "", weight: 2}
+	    - {label: 吉, weight: 7}
+
+A table whose weights sum to zero or that lists a label twice is rejected at
+startup.
+
+The windows key sets the window of individual oracles, overriding WINDOW:
+	timezone: Asia/Shanghai
+	windows:
+	  divine: day
+
+Duration windows do not depend on the timezone: they start at multiples of the
+duration since January 1 of year 1 UTC, so those dividing a day evenly, such as
+"30m" or "6h", start at UTC midnight.
+
+Answers are derived from the user ID, the start of the window and the query
+by a numbered seed scheme. A released scheme never changes, so that upgrading
+pgb does not change anyone's answer; improvements are released as a new
+version, and changing SEED_SCHEME is a deliberate reset of all answers. The
+schemes are:
+	- 1: A SHA-256 digest of the inputs seeds math/rand. This is the original
+	  derivation.
+	- 2: The same digest seeds a math/rand/v2 ChaCha8 generator with all of
+	  its 256 bits. It is about twenty times faster to derive and allocates
+	  a tenth of the memory.
+	- 3: Scheme 2 with the query normalized first, so that "明天会下雨吗" and
+	  "明天会下雨吗？ " get the same answer and retyping a query does not
+	  re-roll it. The steps are NFKC normalization, which maps full-width
+	  letters and punctuation to their usual forms, collapsing whitespace,
+	  stripping trailing punctuation and case folding. The answer still shows
+	  the query as typed. Changing QUERY_NORMALIZATION changes answers.
+
+Without SEED_SECRET the digest is unkeyed, so anyone with the source can
+compute tomorrow's answers and pick a query that comes out 极大吉. With
+SEED_SECRET the digest is an HMAC-SHA256 keyed with the secret, whose input
+starts with the name and version of the scheme, such as "pgb/hmac-sha256/v1".
+Rotating the secret is a deliberate reset of all answers as well; it takes
+effect on SIGHUP like the other secret files.
+
+Sending SIGHUP re-reads the configuration file, the secret files and the
+environment. The enabled oracles, result titles, outcome tables, fortune
+sticks, windows, seed settings and logging take effect immediately; changes
+to other settings are reported and need a restart. An invalid configuration
+is logged and the previous one stays in use.
+
+The choice oracle only answers queries listing two or more options, such as
+"火锅还是烧烤" or "tea / coffee / juice", and picks one of them. Options are
+separated by "还是", "或者", "或", a standalone "or", or a "/" or "|" between
+spaces or Chinese characters, so that "and/or" and URLs are not split.
+
+The dice oracle only answers queries in dice notation and shows every die
+rolled and the total. "2d6+3" rolls two six-sided dice and adds 3, "d20" rolls
+one twenty-sided die, "4d6kh3" keeps the highest three of four dice ("kl" keeps
+the lowest), and "3d10!" rolls a die again whenever it shows its highest side.
+A die that explodes counts as the sum of its rolls when dice are kept. An
+expression rolls at most 100 dice of at most 1000 sides, and explosions add at
+most 100 more.
+
+The tarot oracle draws from the 78 cards of the Rider-Waite deck without
+replacement, each upright or reversed, and reads them in the user's language.
+A single card is drawn unless the query starts with the name of a spread:
+"三张" or "three" for past, present and future, and "凯尔特十字" or "celtic" for
+the ten cards of the Celtic Cross, as in "三张 明天会下雨吗".
+
+The iching oracle casts a hexagram of the Book of Changes with three coins for
+each of its six lines. Old yin and old yang lines change into their opposites,
+and the answer shows the primary hexagram, the changing lines and the
+hexagram they transform it into, each with its judgment.
+
+The lingqian oracle draws one of a temple's numbered fortune sticks and shows
+the name of the set, the grade of the stick, such as 上上 or 下下, its poem
+and its interpretation. The built-in set is an original one of 100 sticks;
+LINGQIAN_FILE loads another set, which may have any number of sticks numbered
+from 1 and an optional name:
+	name: 某寺灵签
+	sticks:
+	  - number: 1
+	    grade: 上上
+	    title: 开天辟地
+	    poem: [紫气东来满院香, 春风得意马蹄忙, 青云有路凭君上, 万事亨通福寿长]
+	    interpretation: 时运亨通，所求皆遂，宜把握良机。
+	  - number: 2
+	    ...
+
+The xiaoliuren oracle casts 小六壬 from the lunar month, the lunar day and the
+double hour (时辰) of the query in TIMEZONE, counting through the palaces
+大安, 留连, 速喜, 赤口, 小吉 and 空亡, and shows the palace with its
+traditional verse. It draws nothing at random, so everyone asking at the same
+time gets the same palace. A leap month counts as the month it repeats, and
+the day changes at 23:00 when 子时 begins. Lunar dates are converted with a
+built-in table covering the lunar years 1900 to 2100.
+
+The almanac oracle shows the day's 黄历 in TIMEZONE: the lunar date, the
+sexagenary terms (干支) of the year, month and day, the zodiac animal of the
+lunar year, the clash and 煞 of the day, and the activities favourable (宜)
+and unfavourable (忌) on it. The year and months follow the solar terms, the
+year starting at 立春, and the 宜 and 忌 follow the officer (建除十二神) of
+the day from a built-in rule set. It is computed locally and is the same for
+everyone, so an inline query that is just "黄历", "老黄历", "宜忌", "almanac"
+or "huangli" shows it alone, and Telegram caches that result for every user
+until midnight, or until the end of a window configured for it. A title
+configured for a particular locale makes the result differ between users, so
+it is then cached only for the user who asked, like all other inline results.
+
+Every enabled oracle is also available as a bot command named after its ID,
+such as "/divine 明天会下雨吗". The reply is the same as the inline result for
+that query at that time. Commands addressed to another bot, such as
+"/dice@OtherBot d20", are ignored.
+
+Besides the webhook, the HTTP server exposes the following endpoints in both
+run modes:
+	- /healthz: Liveness, succeeds while the process serves HTTP.
+	- /readyz: Readiness, succeeds once the bot has passed its getMe check.
+	- /version: Build information as JSON.
+	- /metrics: Prometheus metrics in the text exposition format, covering
+	  inline queries by locale, results and replies sent per oracle, the
+	  outcomes of the divinations sent, Telegram API latency and errors, and
+	  webhook requests.
 
 Example usage:
 
@@ -33,7 +217,29 @@ set:
 	export TOKEN=0123456789:abcdefghijklmnopqrstuvwxyz
 
 Then run the application:
-	go run pgb.go
+	go run .
+
+The binary accepts a subcommand as its first argument:
+	- serve: Run the bot. This is the default when no subcommand is given.
+	- config print: Print the effective configuration, merged from the
+	  configuration file, the environment and the defaults, as YAML with
+	  secrets redacted.
+	- stats: Simulate queries from many users over many time windows through
+	  the same pipeline as real ones, and print the observed and expected
+	  outcome frequencies of every oracle with a chi-square test. Oracles
+	  without a known distribution, such as xiaoliuren and the almanac,
+	  which read the clock rather than draw at random, are listed as not
+	  checked. The configuration is read like that of serve, from the
+	  -config file and the environment, but no token is needed. -n sets the
+	  number of queries and -windows the number of half-hour steps they are
+	  spread over; with -check the command fails if an oracle deviates at the
+	  -alpha significance level (default: 0.001), which "make stats" runs in
+	  CI.
+	- healthcheck: Probe the /healthz endpoint of the server configured by HOST
+	  and PORT, or the URL given with -url, and exit non-zero unless it is
+	  healthy. The runtime image has no curl or wget, so container health
+	  checks use this instead:
+		pgb healthcheck
 */
 
 package main
@@ -1,11 +1,11 @@
 module github.com/YukariExpress/pgb
 
-go 1.26
+go 1.26.0
 
 require (
 	github.com/go-telegram/bot v1.23.0
 	github.com/sethvargo/go-envconfig v1.4.3
 	github.com/stretchr/testify v1.12.1
+	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/text v0.42.0
 )
-
-require go.yaml.in/yaml/v3 v3.0.5 // indirect
@@ -0,0 +1,127 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Paths of the operational HTTP endpoints.
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+	versionPath = "/version"
+)
+
+// status reports the liveness and readiness of the process over HTTP. The
+// zero value is alive but not ready.
+type status struct {
+	ready atomic.Bool
+}
+
+// SetReady marks the process as ready or not ready to receive updates.
+//
+// Parameters:
+//   - ready: Whether readiness probes should pass.
+func (s *status) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// Register mounts the health, readiness and version endpoints on the mux.
+//
+// Parameters:
+//   - mux: The mux to register the endpoints on.
+func (s *status) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+healthzPath, s.healthz)
+	mux.HandleFunc("GET "+readyzPath, s.readyz)
+	mux.HandleFunc("GET "+versionPath, versionHandler)
+}
+
+// healthz answers liveness probes. It succeeds as long as the process is able
+// to serve HTTP.
+func (s *status) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyz answers readiness probes. It succeeds only after the bot passed its
+// getMe check and fails again once shutdown has started.
+func (s *status) readyz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !s.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// BuildInfo describes the running binary as reported by the version endpoint.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// getBuildInfo collects the version injected by the Makefile and the VCS
+// information embedded by the Go toolchain. When no version was injected, the
+// module version recorded by the toolchain is used instead.
+//
+// Returns:
+//   - The build information of the running binary.
+func getBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// versionHandler writes the build information as JSON.
+func versionHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getBuildInfo())
+}
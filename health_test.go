@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusEndpoints(t *testing.T) {
+	var st status
+	mux := http.NewServeMux()
+	st.Register(mux)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get(healthzPath))
+	assert.Equal(t, http.StatusServiceUnavailable, get(readyzPath))
+
+	st.SetReady(true)
+	assert.Equal(t, http.StatusOK, get(healthzPath))
+	assert.Equal(t, http.StatusOK, get(readyzPath))
+
+	st.SetReady(false)
+	assert.Equal(t, http.StatusServiceUnavailable, get(readyzPath))
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "1.2.3"
+
+	var st status
+	mux := http.NewServeMux()
+	st.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, versionPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var info BuildInfo
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
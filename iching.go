@@ -0,0 +1,328 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// hexagramCount is the number of hexagrams of the Book of Changes.
+const hexagramCount = 64
+
+//go:embed data/iching.yaml
+var ichingData []byte
+
+// hexagram is one of the 64 hexagrams of the Book of Changes.
+//
+// Fields:
+//   - Number: The position in the King Wen sequence, from 1 to 64.
+//   - Symbol: The Unicode hexagram symbol, such as "䷀".
+//   - Lines: The six lines from the bottom up, "1" for yang and "0" for yin.
+//   - Name: The name of the hexagram.
+//   - Judgment: The text attached to the hexagram as a whole.
+type hexagram struct {
+	Number   int           `yaml:"number"`
+	Symbol   string        `yaml:"symbol"`
+	Lines    string        `yaml:"lines"`
+	Name     localizedText `yaml:"name"`
+	Judgment localizedText `yaml:"judgment"`
+}
+
+// parseHexagrams parses and validates the hexagrams of the Book of Changes.
+//
+// Parameters:
+//   - data: The hexagrams as YAML, a list under the "hexagrams" key.
+//
+// Returns:
+//   - A map from the lines of every hexagram to the hexagram.
+//   - An error if the data is malformed, the hexagrams are not the 64 in
+//     King Wen order with their Unicode symbols, lines are invalid or
+//     repeated, or a text is missing.
+func parseHexagrams(data []byte) (map[string]*hexagram, error) {
+	var book struct {
+		Hexagrams []hexagram `yaml:"hexagrams"`
+	}
+
+	if err := yaml.Unmarshal(data, &book); err != nil {
+		return nil, err
+	}
+
+	if len(book.Hexagrams) != hexagramCount {
+		return nil, fmt.Errorf("%d hexagrams, want %d", len(book.Hexagrams), hexagramCount)
+	}
+
+	byLines := make(map[string]*hexagram, hexagramCount)
+
+	for i := range book.Hexagrams {
+		h := &book.Hexagrams[i]
+
+		if h.Number != i+1 {
+			return nil, fmt.Errorf("hexagram %d is numbered %d", i+1, h.Number)
+		}
+
+		if want := string(rune(0x4DC0 + i)); h.Symbol != want {
+			return nil, fmt.Errorf("hexagram %d has symbol %q, want %q", h.Number, h.Symbol, want)
+		}
+
+		if len(h.Lines) != 6 || strings.Trim(h.Lines, "01") != "" {
+			return nil, fmt.Errorf("hexagram %d has invalid lines %q", h.Number, h.Lines)
+		}
+
+		if other, ok := byLines[h.Lines]; ok {
+			return nil, fmt.Errorf("hexagrams %d and %d have the same lines", other.Number, h.Number)
+		}
+
+		if !h.Name.isComplete() || !h.Judgment.isComplete() {
+			return nil, fmt.Errorf("hexagram %d is missing a name or judgment", h.Number)
+		}
+
+		byLines[h.Lines] = h
+	}
+
+	return byLines, nil
+}
+
+// hexagrams maps the lines of the embedded hexagrams to the hexagrams.
+var hexagrams = mustParse(parseHexagrams, ichingData)
+
+// castLine casts one line with the three-coin method. Every coin counts 3 for
+// heads and 2 for tails, so the sum is 6 (old yin), 7 (young yang), 8 (young
+// yin) or 9 (old yang) with chances of 1, 3, 3 and 1 in 8.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the random number
+//     generator.
+//
+// Returns:
+//   - The sum of the coins, from 6 to 9.
+func castLine(ctx *UpdateContext) int {
+	sum := 0
+
+	for range 3 {
+		sum += 2 + ctx.Rand.Intn(2)
+	}
+
+	return sum
+}
+
+// castHexagram casts the six lines of a hexagram from the bottom up.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the random number
+//     generator.
+//
+// Returns:
+//   - The primary hexagram.
+//   - The transformed hexagram, in which the old lines have changed into
+//     their opposites, or nil if no line changes.
+//   - The positions of the changing lines, counted from 0 at the bottom.
+func castHexagram(ctx *UpdateContext) (*hexagram, *hexagram, []int) {
+	var primary, transformed [6]byte
+	var changing []int
+
+	for i := range primary {
+		line := castLine(ctx)
+
+		primary[i] = '0' + byte(line%2)
+		transformed[i] = primary[i]
+
+		if line == 6 || line == 9 {
+			transformed[i] = '0' + byte(1-line%2)
+			changing = append(changing, i)
+		}
+	}
+
+	if len(changing) == 0 {
+		return hexagrams[string(primary[:])], nil, nil
+	}
+
+	return hexagrams[string(primary[:])], hexagrams[string(transformed[:])], changing
+}
+
+// lineName returns the traditional name of a line of a hexagram, such as
+// "初九" for a yang line at the bottom or "六三" for a yin line in the third
+// position.
+//
+// Parameters:
+//   - h: The hexagram.
+//   - i: The position of the line, counted from 0 at the bottom.
+//
+// Returns:
+//   - The name of the line.
+func lineName(h *hexagram, i int) string {
+	kind := "六"
+	if h.Lines[i] == '1' {
+		kind = "九"
+	}
+
+	switch i {
+	case 0:
+		return "初" + kind
+	case 5:
+		return "上" + kind
+	default:
+		return kind + []string{"二", "三", "四", "五"}[i-1]
+	}
+}
+
+// The labels of the lines of an I Ching reading.
+var (
+	ichingPrimary     = localizedText{Zh: "\n本卦: ", En: "\nHexagram: "}
+	ichingJudgment    = localizedText{Zh: "\n卦辞: ", En: "\nJudgment: "}
+	ichingChanging    = localizedText{Zh: "\n动爻: ", En: "\nChanging lines: "}
+	ichingTransformed = localizedText{Zh: "\n之卦: ", En: "\nBecomes: "}
+	ichingNoChange    = localizedText{Zh: "无", En: "none"}
+)
+
+// formatHexagram formats the symbol, name and number of a hexagram.
+func formatHexagram(h *hexagram, locale string) string {
+	if locale == "zh" {
+		return fmt.Sprintf("%s %s（第%d卦）", h.Symbol, h.Name.Zh, h.Number)
+	}
+
+	return fmt.Sprintf("%s %d. %s (%s)", h.Symbol, h.Number, h.Name.En, h.Name.Zh)
+}
+
+// consultIChing casts a hexagram for the query of an UpdateContext and reads
+// it in the user's locale.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the query, locale and
+//     random number generator.
+//
+// Returns:
+//   - A string with the query, the primary hexagram and its judgment, the
+//     changing lines and, if any line changes, the transformed hexagram and
+//     its judgment.
+func consultIChing(ctx *UpdateContext) string {
+	var b builder
+
+	locale := *ctx.Locale
+	primary, transformed, changing := castHexagram(ctx)
+
+	if locale == "zh" {
+		b.WriteStrings("所求事项: ", *ctx.Query)
+	} else {
+		b.WriteStrings("Question: ", *ctx.Query)
+	}
+
+	b.WriteStrings(ichingPrimary.In(locale), formatHexagram(primary, locale),
+		ichingJudgment.In(locale), primary.Judgment.In(locale),
+		ichingChanging.In(locale))
+
+	if len(changing) == 0 {
+		b.WriteString(ichingNoChange.In(locale))
+
+		return b.String()
+	}
+
+	for n, i := range changing {
+		if locale == "zh" {
+			if n > 0 {
+				b.WriteString("、")
+			}
+
+			b.WriteString(lineName(primary, i))
+		} else {
+			if n > 0 {
+				b.WriteString(", ")
+			}
+
+			b.WriteString(strconv.Itoa(i + 1))
+		}
+	}
+
+	b.WriteStrings(ichingTransformed.In(locale), formatHexagram(transformed, locale),
+		ichingJudgment.In(locale), transformed.Judgment.In(locale))
+
+	return b.String()
+}
+
+// ichingOracle casts a hexagram of the Book of Changes with three coins.
+type ichingOracle struct{}
+
+func (ichingOracle) ID() string { return "iching" }
+
+func (ichingOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "周易"
+	}
+
+	return "I Ching"
+}
+
+func (ichingOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "以三枚铜钱起卦"
+	}
+
+	return "Cast a hexagram with three coins"
+}
+
+func (ichingOracle) Consult(ctx *UpdateContext) string {
+	return consultIChing(ctx)
+}
+
+// Expected gives the chances of the number of changing lines. Every line
+// changes with a chance of 1 in 4, so the number is binomially distributed.
+func (ichingOracle) Expected(string) []Outcome {
+	outcomes := make([]Outcome, 7)
+
+	for k := range outcomes {
+		ways := 1.0
+		for i := range k {
+			ways = ways * float64(6-i) / float64(i+1)
+		}
+
+		outcomes[k] = Outcome{
+			Label: strconv.Itoa(k),
+			P:     ways * math.Pow(0.25, float64(k)) * math.Pow(0.75, float64(6-k)),
+		}
+	}
+
+	return outcomes
+}
+
+// Outcome counts the changing lines of an answer in any locale.
+func (ichingOracle) Outcome(_, answer string) string {
+	for _, locale := range []string{"zh", "en"} {
+		_, rest, ok := strings.Cut(answer, ichingChanging.In(locale))
+		if !ok {
+			continue
+		}
+
+		lines, _, _ := strings.Cut(rest, "\n")
+		if lines == ichingNoChange.In(locale) {
+			return "0"
+		}
+
+		sep := ", "
+		if locale == "zh" {
+			sep = "、"
+		}
+
+		return strconv.Itoa(strings.Count(lines, sep) + 1)
+	}
+
+	return ""
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHexagrams(t *testing.T) {
+	byLines, err := parseHexagrams(ichingData)
+	require.NoError(t, err)
+	require.Len(t, byLines, 64)
+
+	tests := []struct {
+		lines  string
+		number int
+		name   string
+	}{
+		{"111111", 1, "乾"},
+		{"000000", 2, "坤"},
+		{"100010", 3, "屯"},
+		{"111000", 11, "泰"},
+		{"000111", 12, "否"},
+		{"101010", 63, "既济"},
+		{"010101", 64, "未济"},
+	}
+
+	for _, tt := range tests {
+		h := byLines[tt.lines]
+		if assert.NotNil(t, h, tt.lines) {
+			assert.Equal(t, tt.number, h.Number)
+			assert.Equal(t, tt.name, h.Name.Zh)
+		}
+	}
+}
+
+func TestParseHexagramsErrors(t *testing.T) {
+	entry := func(n int, symbol, lines string) string {
+		return fmt.Sprintf("  - {number: %d, symbol: %s, lines: %q, name: {zh: a, en: b}, judgment: {zh: c, en: d}}\n", n, symbol, lines)
+	}
+
+	valid := func(i int) string {
+		lines := fmt.Sprintf("%06b", i)
+		return entry(i+1, string(rune(0x4DC0+i)), lines)
+	}
+
+	build := func(replace map[int]string) []byte {
+		var b strings.Builder
+		b.WriteString("hexagrams:\n")
+
+		for i := range 64 {
+			if e, ok := replace[i]; ok {
+				b.WriteString(e)
+			} else {
+				b.WriteString(valid(i))
+			}
+		}
+
+		return []byte(b.String())
+	}
+
+	_, err := parseHexagrams(build(nil))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"malformed", []byte("hexagrams: [\n"), "yaml"},
+		{"short", []byte("hexagrams:\n" + valid(0)), "1 hexagrams, want 64"},
+		{"numbering", build(map[int]string{2: entry(4, "䷂", "000010")}), "hexagram 3 is numbered 4"},
+		{"symbol", build(map[int]string{0: entry(1, "䷁", "000000")}), "want \"䷀\""},
+		{"lines", build(map[int]string{0: entry(1, "䷀", "0000002")}), "invalid lines"},
+		{"repeated lines", build(map[int]string{1: entry(2, "䷁", "000000")}), "same lines"},
+		{"missing text", build(map[int]string{0: "  - {number: 1, symbol: ䷀, lines: \"000000\", name: {zh: a}}\n"}), "missing a name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseHexagrams(tt.data)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCastHexagram(t *testing.T) {
+	for seed := range int64(200) {
+		ctx := &UpdateContext{Rand: rand.New(rand.NewSource(seed))}
+		primary, transformed, changing := castHexagram(ctx)
+
+		require.NotNil(t, primary)
+
+		if len(changing) == 0 {
+			assert.Nil(t, transformed)
+			continue
+		}
+
+		require.NotNil(t, transformed)
+
+		for i := range 6 {
+			flipped := primary.Lines[i] != transformed.Lines[i]
+			assert.Equal(t, slices.Contains(changing, i), flipped)
+		}
+	}
+}
+
+func TestLineName(t *testing.T) {
+	qian := hexagrams["111111"]
+	kun := hexagrams["000000"]
+
+	assert.Equal(t, "初九", lineName(qian, 0))
+	assert.Equal(t, "九三", lineName(qian, 2))
+	assert.Equal(t, "上九", lineName(qian, 5))
+	assert.Equal(t, "初六", lineName(kun, 0))
+	assert.Equal(t, "六五", lineName(kun, 4))
+	assert.Equal(t, "上六", lineName(kun, 5))
+}
+
+func TestConsultIChing(t *testing.T) {
+	query := "问题"
+	changed := map[string]bool{}
+
+	for _, locale := range []string{"zh", "en"} {
+		for seed := range int64(20) {
+			ctx := &UpdateContext{Query: &query, Locale: &locale, Rand: rand.New(rand.NewSource(seed))}
+
+			answer := consultIChing(ctx)
+			lines := strings.Split(answer, "\n")
+			outcome := ichingOracle{}.Outcome(query, answer)
+
+			require.NotEmpty(t, outcome, answer)
+
+			if outcome == "0" {
+				assert.Len(t, lines, 4, answer)
+			} else {
+				assert.Len(t, lines, 6, answer)
+				changed[locale] = true
+			}
+		}
+	}
+
+	assert.Len(t, changed, 2)
+}
+
+func TestIChingOutcome(t *testing.T) {
+	o := ichingOracle{}
+
+	var total float64
+	for _, e := range o.Expected("") {
+		total += e.P
+	}
+
+	assert.InDelta(t, 1, total, 1e-12)
+	assert.Equal(t, "0", o.Outcome("", "所求事项: q\n本卦: ䷀ 乾（第1卦）\n卦辞: 元亨利贞。\n动爻: 无"))
+	assert.Equal(t, "2", o.Outcome("", "所求事项: q\n本卦: x\n卦辞: y\n动爻: 初九、九三\n之卦: z\n卦辞: w"))
+	assert.Equal(t, "3", o.Outcome("", "Question: q\nHexagram: x\nJudgment: y\nChanging lines: 1, 3, 6\nBecomes: z\nJudgment: w"))
+	assert.Empty(t, o.Outcome("", "Question: q"))
+}
@@ -0,0 +1,462 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package dice parses and rolls tabletop dice notation such as "2d6+3", "d20",
+// "4d6kh3" and "3d10!". Expressions are bounded, so that rolling any
+// expression Parse accepts takes a small, fixed amount of work.
+package dice
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The limits of an expression.
+const (
+	// MaxDice is the most dice an expression may roll, not counting the
+	// extra dice of explosions.
+	MaxDice = 100
+	// MaxSides is the most sides a die may have.
+	MaxSides = 1000
+	// MaxExplosions is the most extra dice explosions may add to a roll.
+	// Further explosions are ignored.
+	MaxExplosions = 100
+	// MaxTerms is the most terms an expression may add up.
+	MaxTerms = 20
+	// MaxConstant is the largest constant an expression may add.
+	MaxConstant = 1000000
+)
+
+// ErrNoDice is returned for an expression that rolls no dice, such as "3+4".
+var ErrNoDice = errors.New("dice: expression rolls no dice")
+
+// Term is a group of dice or a constant added to or subtracted from the
+// total of an expression.
+//
+// Fields:
+//   - Negative: Whether the term is subtracted.
+//   - Count: The number of dice to roll.
+//   - Sides: The number of sides of each die, or 0 for a constant.
+//   - Constant: The value of a constant term.
+//   - Explode: Whether a die showing its highest side is rolled again and
+//     both are counted.
+//   - Keep: The number of dice to keep, or 0 to keep them all. A die that
+//     explodes is kept or dropped together with the extra dice it added.
+//   - KeepLowest: Whether the lowest rather than the highest dice are kept.
+type Term struct {
+	Negative   bool
+	Count      int
+	Sides      int
+	Constant   int
+	Explode    bool
+	Keep       int
+	KeepLowest bool
+}
+
+// IsDice reports whether the term rolls dice rather than adding a constant.
+func (t Term) IsDice() bool {
+	return t.Sides > 0
+}
+
+// String formats the term in dice notation without its sign.
+func (t Term) String() string {
+	if !t.IsDice() {
+		return strconv.Itoa(t.Constant)
+	}
+
+	var b strings.Builder
+
+	if t.Count != 1 {
+		b.WriteString(strconv.Itoa(t.Count))
+	}
+
+	b.WriteString("d")
+	b.WriteString(strconv.Itoa(t.Sides))
+
+	if t.Explode {
+		b.WriteString("!")
+	}
+
+	if t.Keep > 0 {
+		if t.KeepLowest {
+			b.WriteString("kl")
+		} else {
+			b.WriteString("kh")
+		}
+
+		b.WriteString(strconv.Itoa(t.Keep))
+	}
+
+	return b.String()
+}
+
+// Expr is a parsed dice expression, a sum of terms.
+type Expr struct {
+	Terms []Term
+}
+
+// String formats the expression in canonical dice notation, such as "2d6+3".
+func (e Expr) String() string {
+	var b strings.Builder
+
+	for i, t := range e.Terms {
+		if t.Negative {
+			b.WriteString("-")
+		} else if i > 0 {
+			b.WriteString("+")
+		}
+
+		b.WriteString(t.String())
+	}
+
+	return b.String()
+}
+
+// Parse parses a dice expression. Letters are case-insensitive and spaces
+// around the signs between terms are ignored. The expression must roll at least one die and
+// stay within the limits of this package.
+//
+// Parameters:
+//   - s: The expression, such as "2d6 + 3".
+//
+// Returns:
+//   - The parsed expression.
+//   - An error if s is not a valid dice expression or exceeds a limit.
+func Parse(s string) (Expr, error) {
+	p := parser{s: strings.ToLower(strings.TrimSpace(s))}
+
+	if p.s == "" {
+		return Expr{}, errors.New("dice: empty expression")
+	}
+
+	var e Expr
+	dice := 0
+
+	for p.i < len(p.s) {
+		if len(e.Terms) == MaxTerms {
+			return Expr{}, fmt.Errorf("dice: more than %d terms", MaxTerms)
+		}
+
+		negative := false
+		if c := p.peek(); c == '+' || c == '-' {
+			negative = c == '-'
+			p.i++
+			p.space()
+		} else if len(e.Terms) > 0 {
+			return Expr{}, p.errorf("expected + or -")
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return Expr{}, err
+		}
+
+		t.Negative = negative
+		e.Terms = append(e.Terms, t)
+		p.space()
+
+		if t.IsDice() {
+			dice += t.Count
+		}
+	}
+
+	if dice == 0 {
+		return Expr{}, ErrNoDice
+	}
+
+	if dice > MaxDice {
+		return Expr{}, fmt.Errorf("dice: more than %d dice", MaxDice)
+	}
+
+	return e, nil
+}
+
+// parser is the state of Parse, an expression and the offset of the next
+// byte to read.
+type parser struct {
+	s string
+	i int
+}
+
+// peek returns the next byte, or 0 at the end of the expression.
+func (p *parser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+
+	return 0
+}
+
+// space skips spaces and tabs.
+func (p *parser) space() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// errorf returns a syntax error at the current offset.
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("dice: %s at offset %d of %q", fmt.Sprintf(format, args...), p.i, p.s)
+}
+
+// number reads a decimal number no larger than limit.
+//
+// Parameters:
+//   - name: What the number is, for error messages.
+//   - limit: The largest allowed value.
+//
+// Returns:
+//   - The number.
+//   - Whether a number was read.
+//   - An error if the number exceeds limit.
+func (p *parser) number(name string, limit int) (int, bool, error) {
+	start := p.i
+	n := 0
+
+	for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+		n = n*10 + int(p.s[p.i]-'0')
+		p.i++
+
+		if n > limit {
+			return 0, true, fmt.Errorf("dice: %s larger than %d", name, limit)
+		}
+	}
+
+	return n, p.i > start, nil
+}
+
+// term reads a constant or a group of dice with its modifiers.
+func (p *parser) term() (Term, error) {
+	count, ok, err := p.number("constant", MaxConstant)
+	if err != nil {
+		return Term{}, err
+	}
+
+	if p.peek() != 'd' {
+		if !ok {
+			return Term{}, p.errorf("expected a number or dice")
+		}
+
+		return Term{Constant: count}, nil
+	}
+
+	p.i++
+
+	if count > MaxDice {
+		return Term{}, fmt.Errorf("dice: more than %d dice", MaxDice)
+	}
+
+	t := Term{Count: 1}
+	if ok {
+		t.Count = count
+	}
+
+	if t.Count == 0 {
+		return Term{}, errors.New("dice: cannot roll zero dice")
+	}
+
+	sides, ok, err := p.number("number of sides", MaxSides)
+	if err != nil {
+		return Term{}, err
+	}
+
+	if !ok || sides == 0 {
+		return Term{}, p.errorf("expected the number of sides")
+	}
+
+	t.Sides = sides
+
+	if p.peek() == '!' {
+		p.i++
+
+		if t.Sides == 1 {
+			return Term{}, errors.New("dice: a one-sided die cannot explode")
+		}
+
+		t.Explode = true
+	}
+
+	if p.peek() == 'k' {
+		p.i++
+
+		switch p.peek() {
+		case 'h':
+			p.i++
+		case 'l':
+			p.i++
+			t.KeepLowest = true
+		}
+
+		keep, ok, err := p.number("number of dice to keep", MaxDice)
+		if err != nil {
+			return Term{}, err
+		}
+
+		if !ok || keep == 0 {
+			return Term{}, p.errorf("expected the number of dice to keep")
+		}
+
+		if keep > t.Count {
+			return Term{}, fmt.Errorf("dice: cannot keep %d of %d dice", keep, t.Count)
+		}
+
+		t.Keep = keep
+	}
+
+	return t, nil
+}
+
+// Die is a single rolled die.
+//
+// Fields:
+//   - Value: The side the die shows.
+//   - Exploded: Whether the die showed its highest side and was rolled again.
+//   - Dropped: Whether the die is not counted towards the total.
+type Die struct {
+	Value    int
+	Exploded bool
+	Dropped  bool
+}
+
+// TermResult is the roll of a term.
+//
+// Fields:
+//   - Term: The term rolled.
+//   - Dice: The dice rolled, in order, with the extra dice of explosions
+//     following the dice that exploded. It is empty for a constant.
+//   - Total: The value of the term, before its sign is applied.
+type TermResult struct {
+	Term  Term
+	Dice  []Die
+	Total int
+}
+
+// Result is the roll of an expression.
+//
+// Fields:
+//   - Terms: The results of the terms, in order.
+//   - Total: The sum of the terms.
+type Result struct {
+	Terms []TermResult
+	Total int
+}
+
+// Roll rolls the dice of an expression. The same expression and random
+// number generator state always give the same result.
+//
+// Parameters:
+//   - r: The random number generator to roll with.
+//
+// Returns:
+//   - The result of every term and the total.
+func (e Expr) Roll(r *rand.Rand) Result {
+	res := Result{Terms: make([]TermResult, 0, len(e.Terms))}
+	explosions := MaxExplosions
+
+	for _, t := range e.Terms {
+		tr := TermResult{Term: t}
+
+		if !t.IsDice() {
+			tr.Total = t.Constant
+		} else {
+			tr.Dice = make([]Die, 0, t.Count)
+
+			for range t.Count {
+				d := Die{Value: r.Intn(t.Sides) + 1}
+
+				for t.Explode && d.Value == t.Sides && explosions > 0 {
+					d.Exploded = true
+					tr.Dice = append(tr.Dice, d)
+					explosions--
+
+					d = Die{Value: r.Intn(t.Sides) + 1}
+				}
+
+				tr.Dice = append(tr.Dice, d)
+			}
+
+			if t.Keep > 0 {
+				drop(tr.Dice, t.Count-t.Keep, t.KeepLowest)
+			}
+
+			for _, d := range tr.Dice {
+				if !d.Dropped {
+					tr.Total += d.Value
+				}
+			}
+		}
+
+		if t.Negative {
+			res.Total -= tr.Total
+		} else {
+			res.Total += tr.Total
+		}
+
+		res.Terms = append(res.Terms, tr)
+	}
+
+	return res
+}
+
+// drop marks the dice of the lowest or highest rolls as dropped. A roll is a
+// die followed by the extra dice its explosions added, and counts as their
+// sum. Of rolls with the same sum, the earlier ones are dropped first.
+//
+// Parameters:
+//   - dice: The rolled dice.
+//   - n: The number of rolls to drop.
+//   - highest: Whether to drop the highest rather than the lowest rolls.
+func drop(dice []Die, n int, highest bool) {
+	// starts holds the index of the first die of every roll and sums the
+	// value of every roll.
+	var starts, sums []int
+	for i, d := range dice {
+		if i == 0 || !dice[i-1].Exploded {
+			starts = append(starts, i)
+			sums = append(sums, 0)
+		}
+
+		sums[len(sums)-1] += d.Value
+	}
+
+	order := make([]int, len(starts))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		if highest {
+			return sums[order[a]] > sums[order[b]]
+		}
+
+		return sums[order[a]] < sums[order[b]]
+	})
+
+	for _, r := range order[:n] {
+		end := len(dice)
+		if r+1 < len(starts) {
+			end = starts[r+1]
+		}
+
+		for i := starts[r]; i < end; i++ {
+			dice[i].Dropped = true
+		}
+	}
+}
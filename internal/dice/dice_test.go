@@ -0,0 +1,225 @@
+package dice
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"d20", "d20"},
+		{"1d20", "d20"},
+		{"2d6+3", "2d6+3"},
+		{"2D6 + 3", "2d6+3"},
+		{"4d6kh3", "4d6kh3"},
+		{"4d6k3", "4d6kh3"},
+		{"2d20kl1", "2d20kl1"},
+		{"3d10!", "3d10!"},
+		{"5d6!kh3", "5d6!kh3"},
+		{"-1+d4", "-1+d4"},
+		{"d8-2+d4", "d8-2+d4"},
+		{"100d1000", "100d1000"},
+		{"d6+1000000", "d6+1000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			e, err := Parse(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, e.String())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr string
+	}{
+		{"", "empty expression"},
+		{"3+4", "rolls no dice"},
+		{"明天会下雨吗", "expected a number or dice"},
+		{"d", "expected the number of sides"},
+		{"d0", "expected the number of sides"},
+		{"0d6", "zero dice"},
+		{"2d6+", "expected a number or dice"},
+		{"2d6 3", "expected + or -"},
+		{"d20 please", "expected + or -"},
+		{"101d6", "more than 100 dice"},
+		{"60d6+60d6", "more than 100 dice"},
+		{"d1001", "larger than 1000"},
+		{"d6+1000001", "larger than 1000000"},
+		{"d6+99999999999999999999999", "larger than 1000000"},
+		{"d1!", "cannot explode"},
+		{"2d6kh3", "cannot keep 3 of 2"},
+		{"4d6kh0", "number of dice to keep"},
+		{"4d6kh", "number of dice to keep"},
+		{"d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6+d6", "more than 20 terms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := Parse(tt.in)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, s string) Expr {
+	t.Helper()
+
+	e, err := Parse(s)
+	require.NoError(t, err)
+
+	return e
+}
+
+func TestRoll(t *testing.T) {
+	e := mustParse(t, "2d6+3")
+
+	for seed := range int64(200) {
+		res := e.Roll(rand.New(rand.NewSource(seed)))
+
+		require.Len(t, res.Terms, 2)
+		assert.Len(t, res.Terms[0].Dice, 2)
+		assert.Equal(t, 3, res.Terms[1].Total)
+		assert.GreaterOrEqual(t, res.Total, 5)
+		assert.LessOrEqual(t, res.Total, 15)
+		assert.Equal(t, res.Terms[0].Total+3, res.Total)
+	}
+}
+
+func TestRollIsDeterministic(t *testing.T) {
+	e := mustParse(t, "4d6kh3+3d10!-d4")
+
+	a := e.Roll(rand.New(rand.NewSource(42)))
+	b := e.Roll(rand.New(rand.NewSource(42)))
+
+	assert.Equal(t, a, b)
+}
+
+func TestRollNegative(t *testing.T) {
+	res := mustParse(t, "d1-5").Roll(rand.New(rand.NewSource(1)))
+
+	assert.Equal(t, -4, res.Total)
+	assert.Equal(t, 5, res.Terms[1].Total)
+}
+
+func TestRollKeep(t *testing.T) {
+	for _, s := range []string{"4d6kh3", "4d6kl3"} {
+		e := mustParse(t, s)
+
+		for seed := range int64(200) {
+			tr := e.Roll(rand.New(rand.NewSource(seed))).Terms[0]
+
+			var kept, dropped []int
+			for _, d := range tr.Dice {
+				if d.Dropped {
+					dropped = append(dropped, d.Value)
+				} else {
+					kept = append(kept, d.Value)
+				}
+			}
+
+			require.Len(t, kept, 3, s)
+			require.Len(t, dropped, 1, s)
+
+			for _, k := range kept {
+				if e.Terms[0].KeepLowest {
+					assert.LessOrEqual(t, k, dropped[0], s)
+				} else {
+					assert.GreaterOrEqual(t, k, dropped[0], s)
+				}
+			}
+		}
+	}
+}
+
+func TestRollExplode(t *testing.T) {
+	// A two-sided die explodes half of the time.
+	e := mustParse(t, "10d2!")
+	exploded := false
+
+	for seed := range int64(50) {
+		tr := e.Roll(rand.New(rand.NewSource(seed))).Terms[0]
+
+		var base, total int
+		for _, d := range tr.Dice {
+			total += d.Value
+			if d.Exploded {
+				exploded = true
+				assert.Equal(t, 2, d.Value)
+			} else {
+				base++
+			}
+		}
+
+		assert.Equal(t, 10, base)
+		assert.Equal(t, total, tr.Total)
+	}
+
+	assert.True(t, exploded)
+}
+
+func TestRollExplodeKeep(t *testing.T) {
+	// Exploded dice are kept or dropped with the die they exploded from, so
+	// the kept roll is the highest sum of a die and its explosions.
+	e := mustParse(t, "2d6!kh1")
+	exploded := false
+
+	for seed := range int64(200) {
+		tr := e.Roll(rand.New(rand.NewSource(seed))).Terms[0]
+
+		var sums []int
+		var dropped []bool
+		next := true
+		for _, d := range tr.Dice {
+			if next {
+				sums = append(sums, 0)
+				dropped = append(dropped, d.Dropped)
+			}
+
+			sums[len(sums)-1] += d.Value
+			assert.Equal(t, dropped[len(dropped)-1], d.Dropped)
+			next = !d.Exploded
+			exploded = exploded || d.Exploded
+		}
+
+		require.Len(t, sums, 2)
+		assert.Equal(t, max(sums[0], sums[1]), tr.Total)
+		assert.NotEqual(t, dropped[0], dropped[1])
+	}
+
+	assert.True(t, exploded)
+}
+
+// alwaysMax is a source that always rolls the highest side.
+type alwaysMax struct{}
+
+func (alwaysMax) Int63() int64 { return 1<<63 - 1 }
+func (alwaysMax) Seed(int64)   {}
+
+func TestRollExplosionLimit(t *testing.T) {
+	res := mustParse(t, "100d2!").Roll(rand.New(alwaysMax{}))
+	dice := res.Terms[0].Dice
+
+	assert.Len(t, dice, 100+MaxExplosions)
+
+	exploded := 0
+	for _, d := range dice {
+		if d.Exploded {
+			exploded++
+		}
+	}
+
+	assert.Equal(t, MaxExplosions, exploded)
+	assert.Equal(t, 2*len(dice), res.Total)
+}
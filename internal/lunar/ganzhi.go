@@ -0,0 +1,159 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package lunar
+
+import (
+	"math"
+	"time"
+)
+
+// zodiacs are the animals of the twelve earthly branches.
+var zodiacs = [...]string{"鼠", "牛", "虎", "兔", "龙", "蛇", "马", "羊", "猴", "鸡", "狗", "猪"}
+
+// GanZhi is a term of the sexagenary cycle, from 0 for 甲子 to 59 for 癸亥.
+type GanZhi int
+
+// NewGanZhi returns the term of a heavenly stem and an earthly branch. The
+// stem and the branch must be both even or both odd.
+//
+// Parameters:
+//   - stem: The heavenly stem, from 0 for 甲 to 9 for 癸.
+//   - branch: The earthly branch, from 0 for 子 to 11 for 亥.
+//
+// Returns:
+//   - The term of the cycle.
+func NewGanZhi(stem, branch int) GanZhi {
+	return GanZhi(((6*stem-5*branch)%60 + 60) % 60)
+}
+
+// Stem returns the heavenly stem of the term, from 0 for 甲 to 9 for 癸.
+func (g GanZhi) Stem() int {
+	return int(g) % 10
+}
+
+// Branch returns the earthly branch of the term, from 0 for 子 to 11 for 亥.
+func (g GanZhi) Branch() int {
+	return int(g) % 12
+}
+
+// Zodiac returns the animal of the branch of the term, such as "龙" for
+// 甲辰.
+func (g GanZhi) Zodiac() string {
+	return zodiacs[g.Branch()]
+}
+
+// String returns the name of the term, such as "甲辰".
+func (g GanZhi) String() string {
+	return stems[g.Stem()] + branches[g.Branch()]
+}
+
+// dayEpoch is a 甲子 day.
+var dayEpoch = time.Date(1949, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+// DayGanZhi returns the sexagenary term of the calendar date of a time. Only
+// the year, month and day of t in its own location count.
+//
+// Parameters:
+//   - t: The time.
+//
+// Returns:
+//   - The term of the day.
+func DayGanZhi(t time.Time) GanZhi {
+	y, m, d := t.Date()
+	days := int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(dayEpoch) / (24 * time.Hour))
+
+	return GanZhi((days%60 + 60) % 60)
+}
+
+// cst is China Standard Time, in which the solar terms are reckoned.
+var cst = time.FixedZone("CST", 8*60*60)
+
+// SunLongitude returns the apparent ecliptic longitude of the sun at a time
+// with the low-precision formulas of Meeus' Astronomical Algorithms, chapter
+// 25. It is accurate to about 0.01°, which puts the solar terms within a
+// quarter of an hour.
+//
+// Parameters:
+//   - t: The time.
+//
+// Returns:
+//   - The longitude in degrees, from 0 up to 360.
+func SunLongitude(t time.Time) float64 {
+	const j2000 = 946728000 // 2000-01-01 12:00 TT, taken as UTC.
+
+	c := float64(t.Unix()-j2000) / 86400 / 36525
+	rad := math.Pi / 180
+
+	l0 := 280.46646 + 36000.76983*c + 0.0003032*c*c
+	m := (357.52911 + 35999.05029*c - 0.0001537*c*c) * rad
+	center := (1.914602-0.004817*c-0.000014*c*c)*math.Sin(m) +
+		(0.019993-0.000101*c)*math.Sin(2*m) +
+		0.000289*math.Sin(3*m)
+	omega := (125.04 - 1934.136*c) * rad
+
+	lambda := math.Mod(l0+center-0.00569-0.00478*math.Sin(omega), 360)
+	if lambda < 0 {
+		lambda += 360
+	}
+
+	return lambda
+}
+
+// solarMonth returns the solar month of the calendar date of a time: 0 for
+// the month from 立春 to 惊蛰, whose branch is 寅, up to 11 for the month
+// from 小寒 to 立春. A month starts on the date in China Standard Time on
+// which its solar term falls.
+func solarMonth(t time.Time) int {
+	y, m, d := t.Date()
+	end := time.Date(y, m, d+1, 0, 0, 0, 0, cst)
+
+	return int(math.Mod(SunLongitude(end)+45, 360) / 30)
+}
+
+// SolarYearGanZhi returns the sexagenary term of the year of the calendar
+// date of a time. Unlike Date.YearGanZhi, the year starts at 立春 rather than
+// at the Spring Festival, as in the four pillars of an almanac.
+//
+// Parameters:
+//   - t: The time. Only its calendar date counts.
+//
+// Returns:
+//   - The term of the year.
+func SolarYearGanZhi(t time.Time) GanZhi {
+	year := t.Year()
+	if t.Month() <= time.February && solarMonth(t) >= 10 {
+		year--
+	}
+
+	return GanZhi(((year-4)%60 + 60) % 60)
+}
+
+// MonthGanZhi returns the sexagenary term of the solar month of the calendar
+// date of a time. Months start at the twelve 节 solar terms, the first at
+// 立春, and their stems follow from the stem of the year.
+//
+// Parameters:
+//   - t: The time. Only its calendar date counts.
+//
+// Returns:
+//   - The term of the month.
+func MonthGanZhi(t time.Time) GanZhi {
+	month := solarMonth(t)
+	stem := (SolarYearGanZhi(t).Stem()*2 + 2 + month) % 10
+
+	return NewGanZhi(stem, (month+2)%12)
+}
@@ -0,0 +1,101 @@
+package lunar
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGanZhi(t *testing.T) {
+	for g := GanZhi(0); g < 60; g++ {
+		assert.Equal(t, g, NewGanZhi(g.Stem(), g.Branch()), g.String())
+	}
+
+	assert.Equal(t, "甲子", GanZhi(0).String())
+	assert.Equal(t, "癸亥", GanZhi(59).String())
+	assert.Equal(t, "甲辰", NewGanZhi(0, 4).String())
+	assert.Equal(t, "龙", NewGanZhi(0, 4).Zodiac())
+}
+
+func TestDayGanZhi(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{date(1900, time.January, 1), "甲戌"},
+		{date(1900, time.January, 31), "甲辰"},
+		{date(1949, time.September, 30), "癸亥"},
+		{date(1949, time.October, 1), "甲子"},
+		{date(2000, time.January, 1), "戊午"},
+		{date(2024, time.February, 10), "甲辰"},
+		{date(2026, time.October, 16), "癸亥"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, DayGanZhi(tt.date).String(), tt.date)
+	}
+}
+
+func TestDayGanZhiIgnoresClock(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	midnight := time.Date(2024, time.February, 10, 0, 30, 0, 0, shanghai)
+
+	assert.Equal(t, "甲辰", DayGanZhi(midnight).String())
+	assert.Equal(t, "癸卯", DayGanZhi(midnight.UTC()).String())
+}
+
+func TestSunLongitude(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		want float64
+	}{
+		// The equinoxes and solstices of 2024.
+		{time.Date(2024, time.March, 20, 3, 6, 0, 0, time.UTC), 0},
+		{time.Date(2024, time.June, 20, 20, 51, 0, 0, time.UTC), 90},
+		{time.Date(2024, time.September, 22, 12, 44, 0, 0, time.UTC), 180},
+		{time.Date(2024, time.December, 21, 9, 21, 0, 0, time.UTC), 270},
+	}
+
+	for _, tt := range tests {
+		got := SunLongitude(tt.time)
+		diff := math.Mod(got-tt.want+540, 360) - 180
+		assert.InDelta(t, 0, diff, 0.02, tt.time)
+	}
+}
+
+func TestMonthGanZhi(t *testing.T) {
+	tests := []struct {
+		date       time.Time
+		year, want string
+	}{
+		// 立春 fell on 2024-02-04 at 16:27 in China.
+		{date(2024, time.February, 3), "癸卯", "乙丑"},
+		{date(2024, time.February, 4), "甲辰", "丙寅"},
+		// 惊蛰 on 2024-03-05.
+		{date(2024, time.March, 4), "甲辰", "丙寅"},
+		{date(2024, time.March, 5), "甲辰", "丁卯"},
+		// 寒露 on 2024-10-08.
+		{date(2024, time.October, 16), "甲辰", "甲戌"},
+		// 大雪 on 2024-12-06 at 23:17 in China.
+		{date(2024, time.December, 5), "甲辰", "乙亥"},
+		{date(2024, time.December, 6), "甲辰", "丙子"},
+		// 小寒 on 2025-01-05, 立春 on 2025-02-03.
+		{date(2025, time.January, 4), "甲辰", "丙子"},
+		{date(2025, time.January, 5), "甲辰", "丁丑"},
+		{date(2025, time.February, 2), "甲辰", "丁丑"},
+		{date(2025, time.February, 3), "乙巳", "戊寅"},
+		{date(2026, time.October, 16), "丙午", "戊戌"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.year, SolarYearGanZhi(tt.date).String(), tt.date)
+		assert.Equal(t, tt.want, MonthGanZhi(tt.date).String(), tt.date)
+	}
+}
+
+func TestDateZodiac(t *testing.T) {
+	assert.Equal(t, "龙", Date{Year: 2024, Month: 1, Day: 1}.Zodiac())
+	assert.Equal(t, "马", Date{Year: 2026, Month: 9, Day: 6}.Zodiac())
+}
@@ -0,0 +1,235 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package lunar converts Gregorian dates to dates of the Chinese lunisolar
+// calendar between 1900 and 2100. It is self-contained: the months of every
+// lunar year come from a table rather than from astronomical computation.
+// It also names the years, months and days of a date in the sexagenary
+// cycle, for which the months follow the solar terms.
+package lunar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The range of the conversion.
+const (
+	MinYear = 1900
+	MaxYear = 2100
+)
+
+// lunarInfo describes the lunar years from 1900 to 2100. Bits 0-3 hold the
+// leap month, or 0 if the year has none; bits 4-15 tell whether months 12
+// down to 1 have 30 days rather than 29, month 1 in bit 15; and bit 16 tells
+// whether the leap month has 30 days.
+var lunarInfo = [MaxYear - MinYear + 1]uint32{
+	0x04bd8, 0x04ae0, 0x0a570, 0x054d5, 0x0d260, 0x0d950, 0x16554, 0x056a0, 0x09ad0, 0x055d2, // 1900
+	0x04ae0, 0x0a5b6, 0x0a4d0, 0x0d250, 0x1d255, 0x0b540, 0x0d6a0, 0x0ada2, 0x095b0, 0x14977, // 1910
+	0x04970, 0x0a4b0, 0x0b4b5, 0x06a50, 0x06d40, 0x1ab54, 0x02b60, 0x09570, 0x052f2, 0x04970, // 1920
+	0x06566, 0x0d4a0, 0x0ea50, 0x16a95, 0x05ad0, 0x02b60, 0x186e3, 0x092e0, 0x1c8d7, 0x0c950, // 1930
+	0x0d4a0, 0x1d8a6, 0x0b550, 0x056a0, 0x1a5b4, 0x025d0, 0x092d0, 0x0d2b2, 0x0a950, 0x0b557, // 1940
+	0x06ca0, 0x0b550, 0x15355, 0x04da0, 0x0a5b0, 0x14573, 0x052b0, 0x0a9a8, 0x0e950, 0x06aa0, // 1950
+	0x0aea6, 0x0ab50, 0x04b60, 0x0aae4, 0x0a570, 0x05260, 0x0f263, 0x0d950, 0x05b57, 0x056a0, // 1960
+	0x096d0, 0x04dd5, 0x04ad0, 0x0a4d0, 0x0d4d4, 0x0d250, 0x0d558, 0x0b540, 0x0b6a0, 0x195a6, // 1970
+	0x095b0, 0x049b0, 0x0a974, 0x0a4b0, 0x0b27a, 0x06a50, 0x06d40, 0x0af46, 0x0ab60, 0x09570, // 1980
+	0x04af5, 0x04970, 0x064b0, 0x074a3, 0x0ea50, 0x06b58, 0x05ac0, 0x0ab60, 0x096d5, 0x092e0, // 1990
+	0x0c960, 0x0d954, 0x0d4a0, 0x0da50, 0x07552, 0x056a0, 0x0abb7, 0x025d0, 0x092d0, 0x0cab5, // 2000
+	0x0a950, 0x0b4a0, 0x0baa4, 0x0ad50, 0x055d9, 0x04ba0, 0x0a5b0, 0x15176, 0x052b0, 0x0a930, // 2010
+	0x07954, 0x06aa0, 0x0ad50, 0x05b52, 0x04b60, 0x0a6e6, 0x0a4e0, 0x0d260, 0x0ea65, 0x0d530, // 2020
+	0x05aa0, 0x076a3, 0x096d0, 0x04afb, 0x04ad0, 0x0a4d0, 0x1d0b6, 0x0d250, 0x0d520, 0x0dd45, // 2030
+	0x0b5a0, 0x056d0, 0x055b2, 0x049b0, 0x0a577, 0x0a4b0, 0x0aa50, 0x1b255, 0x06d20, 0x0ada0, // 2040
+	0x14b63, 0x09370, 0x049f8, 0x04970, 0x064b0, 0x168a6, 0x0ea50, 0x06b20, 0x1a6c4, 0x0aae0, // 2050
+	0x092e0, 0x0d2e3, 0x0c960, 0x0d557, 0x0d4a0, 0x0da50, 0x05d55, 0x056a0, 0x0a6d0, 0x055d4, // 2060
+	0x052d0, 0x0a9b8, 0x0a950, 0x0b4a0, 0x0b6a6, 0x0ad50, 0x055a0, 0x0aba4, 0x0a5b0, 0x052b0, // 2070
+	0x0b273, 0x06930, 0x07337, 0x06aa0, 0x0ad50, 0x14b55, 0x04b60, 0x0a570, 0x054e4, 0x0d160, // 2080
+	0x0e968, 0x0d520, 0x0daa0, 0x16aa6, 0x056d0, 0x04ae0, 0x0a9d4, 0x0a2d0, 0x0d150, 0x0f252, // 2090
+	0x0d520, // 2100
+}
+
+// epoch is the Gregorian date of the first day of lunar year 1900.
+var epoch = time.Date(1900, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+// ErrOutOfRange is returned for dates outside the lunar years 1900 to 2100.
+var ErrOutOfRange = errors.New("lunar: date out of range")
+
+// LeapMonth returns the leap month of a lunar year.
+//
+// Parameters:
+//   - year: The lunar year, from 1900 to 2100.
+//
+// Returns:
+//   - The month the leap month follows, or 0 if the year has none.
+func LeapMonth(year int) int {
+	return int(lunarInfo[year-MinYear] & 0xf)
+}
+
+// MonthDays returns the length of a month of a lunar year.
+//
+// Parameters:
+//   - year: The lunar year, from 1900 to 2100.
+//   - month: The month, from 1 to 12.
+//   - leap: Whether the month is the leap month following month.
+//
+// Returns:
+//   - 29 or 30, or 0 for a leap month the year does not have.
+func MonthDays(year, month int, leap bool) int {
+	info := lunarInfo[year-MinYear]
+
+	if leap {
+		switch {
+		case LeapMonth(year) != month:
+			return 0
+		case info&0x10000 != 0:
+			return 30
+		default:
+			return 29
+		}
+	}
+
+	if info&(0x10000>>uint(month)) != 0 {
+		return 30
+	}
+
+	return 29
+}
+
+// YearDays returns the length of a lunar year, including its leap month.
+//
+// Parameters:
+//   - year: The lunar year, from 1900 to 2100.
+//
+// Returns:
+//   - The number of days in the year.
+func YearDays(year int) int {
+	days := 0
+
+	for month := 1; month <= 12; month++ {
+		days += MonthDays(year, month, false) + MonthDays(year, month, true)
+	}
+
+	return days
+}
+
+// Date is a date of the Chinese lunisolar calendar.
+//
+// Fields:
+//   - Year: The lunar year, which starts at the Spring Festival.
+//   - Month: The month, from 1 to 12.
+//   - Day: The day of the month, from 1 to 30.
+//   - Leap: Whether the month is the leap month following Month.
+type Date struct {
+	Year  int
+	Month int
+	Day   int
+	Leap  bool
+}
+
+// FromSolar converts the calendar date of a time to a lunar date. Only the
+// year, month and day of t in its own location count.
+//
+// Parameters:
+//   - t: The time.
+//
+// Returns:
+//   - The lunar date.
+//   - ErrOutOfRange if the date lies outside the lunar years 1900 to 2100.
+func FromSolar(t time.Time) (Date, error) {
+	y, m, d := t.Date()
+	offset := int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(epoch) / (24 * time.Hour))
+
+	if offset < 0 {
+		return Date{}, ErrOutOfRange
+	}
+
+	year := MinYear
+	for ; year <= MaxYear; year++ {
+		days := YearDays(year)
+		if offset < days {
+			break
+		}
+
+		offset -= days
+	}
+
+	if year > MaxYear {
+		return Date{}, ErrOutOfRange
+	}
+
+	for month := 1; month <= 12; month++ {
+		for _, leap := range []bool{false, true} {
+			days := MonthDays(year, month, leap)
+			if offset < days {
+				return Date{Year: year, Month: month, Day: offset + 1, Leap: leap}, nil
+			}
+
+			offset -= days
+		}
+	}
+
+	// The year holds every remaining day.
+	panic(fmt.Sprintf("lunar: day %d past the end of year %d", offset, year))
+}
+
+var (
+	monthNames = [...]string{"正", "二", "三", "四", "五", "六", "七", "八", "九", "十", "冬", "腊"}
+	dayTens    = [...]string{"初", "十", "廿", "三"}
+	digits     = [...]string{"十", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+	stems      = [...]string{"甲", "乙", "丙", "丁", "戊", "己", "庚", "辛", "壬", "癸"}
+	branches   = [...]string{"子", "丑", "寅", "卯", "辰", "巳", "午", "未", "申", "酉", "戌", "亥"}
+)
+
+// MonthName returns the Chinese name of the month, such as "正月" or
+// "闰四月".
+func (d Date) MonthName() string {
+	name := monthNames[d.Month-1] + "月"
+	if d.Leap {
+		return "闰" + name
+	}
+
+	return name
+}
+
+// DayName returns the Chinese name of the day, such as "初一", "十五" or
+// "廿三".
+func (d Date) DayName() string {
+	switch d.Day {
+	case 10:
+		return "初十"
+	case 20:
+		return "二十"
+	case 30:
+		return "三十"
+	}
+
+	return dayTens[d.Day/10] + digits[d.Day%10]
+}
+
+// YearGanZhi returns the sexagenary name of the lunar year, such as "甲辰".
+func (d Date) YearGanZhi() string {
+	return GanZhi((d.Year - 4) % 60).String()
+}
+
+// Zodiac returns the animal of the lunar year, such as "龙".
+func (d Date) Zodiac() string {
+	return GanZhi((d.Year - 4) % 60).Zodiac()
+}
+
+// String formats the date in Chinese, such as "甲辰年闰四月初三".
+func (d Date) String() string {
+	return d.YearGanZhi() + "年" + d.MonthName() + d.DayName()
+}
@@ -0,0 +1,151 @@
+package lunar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+}
+
+func TestFromSolar(t *testing.T) {
+	tests := []struct {
+		name  string
+		solar time.Time
+		want  Date
+	}{
+		{"epoch", date(1900, time.January, 31), Date{Year: 1900, Month: 1, Day: 1}},
+		{"spring festival 1949", date(1949, time.January, 29), Date{Year: 1949, Month: 1, Day: 1}},
+		{"spring festival 1980", date(1980, time.February, 16), Date{Year: 1980, Month: 1, Day: 1}},
+		{"spring festival 2000", date(2000, time.February, 5), Date{Year: 2000, Month: 1, Day: 1}},
+		{"spring festival 2021", date(2021, time.February, 12), Date{Year: 2021, Month: 1, Day: 1}},
+		{"spring festival 2024", date(2024, time.February, 10), Date{Year: 2024, Month: 1, Day: 1}},
+		{"spring festival 2026", date(2026, time.February, 17), Date{Year: 2026, Month: 1, Day: 1}},
+		{"spring festival 2050", date(2050, time.January, 23), Date{Year: 2050, Month: 1, Day: 1}},
+		{"new year's eve 2024", date(2024, time.February, 9), Date{Year: 2023, Month: 12, Day: 30}},
+		{"mid-autumn 2024", date(2024, time.September, 17), Date{Year: 2024, Month: 8, Day: 15}},
+		{"dragon boat 2025", date(2025, time.May, 31), Date{Year: 2025, Month: 5, Day: 5}},
+		{"new year's day 2025", date(2025, time.January, 1), Date{Year: 2024, Month: 12, Day: 2}},
+		{"before leap 4 2020", date(2020, time.May, 22), Date{Year: 2020, Month: 4, Day: 30}},
+		{"leap 4 2020", date(2020, time.May, 23), Date{Year: 2020, Month: 4, Day: 1, Leap: true}},
+		{"after leap 4 2020", date(2020, time.June, 21), Date{Year: 2020, Month: 5, Day: 1}},
+		{"leap 2 2023", date(2023, time.March, 22), Date{Year: 2023, Month: 2, Day: 1, Leap: true}},
+		{"leap 6 2017", date(2017, time.July, 23), Date{Year: 2017, Month: 6, Day: 1, Leap: true}},
+		{"leap 6 2025", date(2025, time.July, 25), Date{Year: 2025, Month: 6, Day: 1, Leap: true}},
+		{"leap 6 2025 end", date(2025, time.August, 22), Date{Year: 2025, Month: 6, Day: 29, Leap: true}},
+		{"after leap 6 2025", date(2025, time.August, 23), Date{Year: 2025, Month: 7, Day: 1}},
+		{"leap 9 2014", date(2014, time.October, 24), Date{Year: 2014, Month: 9, Day: 1, Leap: true}},
+		{"last day", date(2100, time.December, 31), Date{Year: 2100, Month: 12, Day: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromSolar(tt.solar)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFromSolarIgnoresClock(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+
+	// 2024-02-09 20:00 UTC is already the Spring Festival in Shanghai.
+	utc := time.Date(2024, time.February, 9, 20, 0, 0, 0, time.UTC)
+
+	got, err := FromSolar(utc)
+	require.NoError(t, err)
+	assert.Equal(t, Date{Year: 2023, Month: 12, Day: 30}, got)
+
+	got, err = FromSolar(utc.In(shanghai))
+	require.NoError(t, err)
+	assert.Equal(t, Date{Year: 2024, Month: 1, Day: 1}, got)
+}
+
+func TestFromSolarOutOfRange(t *testing.T) {
+	for _, d := range []time.Time{date(1900, time.January, 30), date(2101, time.January, 29), date(1, time.January, 1)} {
+		_, err := FromSolar(d)
+		assert.ErrorIs(t, err, ErrOutOfRange, d)
+	}
+}
+
+func TestLeapMonth(t *testing.T) {
+	tests := []struct {
+		year int
+		want int
+	}{
+		{2017, 6},
+		{2020, 4},
+		{2023, 2},
+		{2024, 0},
+		{2025, 6},
+		{2033, 11},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, LeapMonth(tt.year), tt.year)
+	}
+}
+
+func TestMonthDays(t *testing.T) {
+	assert.Equal(t, 29, MonthDays(2025, 6, true))
+	assert.Equal(t, 0, MonthDays(2025, 5, true))
+	assert.Equal(t, 30, MonthDays(2023, 12, false))
+	assert.Equal(t, 384, YearDays(2025))
+	assert.Equal(t, 354, YearDays(2024))
+}
+
+// TestYearsAreContiguous walks every day of the range and checks that the
+// lunar date advances by exactly one day each time.
+func TestYearsAreContiguous(t *testing.T) {
+	prev, err := FromSolar(date(1900, time.January, 31))
+	require.NoError(t, err)
+
+	for d := date(1900, time.February, 1); d.Year() <= 2100; d = d.AddDate(0, 0, 1) {
+		got, err := FromSolar(d)
+		require.NoError(t, err)
+
+		switch {
+		case got.Day == prev.Day+1:
+			assert.Equal(t, prev.Month, got.Month, d)
+			assert.Equal(t, prev.Leap, got.Leap, d)
+		case got.Day == 1 && got.Leap:
+			assert.Equal(t, prev.Month, got.Month, d)
+		case got.Day == 1 && got.Month == 1:
+			assert.Equal(t, 12, prev.Month, d)
+			assert.Equal(t, prev.Year+1, got.Year, d)
+		case got.Day == 1:
+			assert.Equal(t, prev.Month+1, got.Month, d)
+		default:
+			t.Fatalf("%s: %+v follows %+v", d.Format(time.DateOnly), got, prev)
+		}
+
+		if got.Day == 1 {
+			assert.GreaterOrEqual(t, prev.Day, 29, d)
+		}
+
+		prev = got
+	}
+}
+
+func TestDateString(t *testing.T) {
+	tests := []struct {
+		date Date
+		want string
+	}{
+		{Date{Year: 2024, Month: 1, Day: 1}, "甲辰年正月初一"},
+		{Date{Year: 2020, Month: 4, Day: 10, Leap: true}, "庚子年闰四月初十"},
+		{Date{Year: 2025, Month: 11, Day: 15}, "乙巳年冬月十五"},
+		{Date{Year: 2023, Month: 12, Day: 20}, "癸卯年腊月二十"},
+		{Date{Year: 1900, Month: 3, Day: 23}, "庚子年三月廿三"},
+		{Date{Year: 1984, Month: 8, Day: 30}, "甲子年八月三十"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.date.String())
+	}
+}
@@ -0,0 +1,419 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package metrics implements labelled counters and histograms and writes them
+// in the Prometheus text exposition format. It covers only what pgb needs and
+// has no dependencies outside the standard library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds, suitable for
+// network request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write itself in the text format.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and exposes them over HTTP. The zero value is
+// an empty registry ready to use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry.
+//
+// Returns:
+//   - A pointer to a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds a collector to the registry.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all metric families in registration order in the text
+// exposition format.
+//
+// Parameters:
+//   - w: The writer receiving the exposition.
+//
+// Returns:
+//   - The number of bytes written.
+//   - An error if writing failed.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+// ServeHTTP writes the exposition as the response body.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// family holds the children of a labelled metric, keyed by their label values.
+type family[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	create func() *T
+
+	mu       sync.RWMutex
+	children map[string]*child[T]
+}
+
+// child is one labelled series of a family.
+type child[T any] struct {
+	values []string
+	metric *T
+}
+
+// with returns the child for the label values, creating it on first use.
+func (f *family[T]) with(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	c, ok := f.children[key]
+	f.mu.RUnlock()
+	if ok {
+		return c.metric
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c, ok := f.children[key]; ok {
+		return c.metric
+	}
+
+	c = &child[T]{values: slices.Clone(values), metric: f.create()}
+	f.children[key] = c
+
+	return c.metric
+}
+
+// sorted returns the children ordered by their label values so that the
+// exposition is stable.
+func (f *family[T]) sorted() []*child[T] {
+	f.mu.RLock()
+	children := make([]*child[T], 0, len(f.children))
+	for _, c := range f.children {
+		children = append(children, c)
+	}
+	f.mu.RUnlock()
+
+	slices.SortFunc(children, func(a, b *child[T]) int {
+		return slices.Compare(a.values, b.values)
+	})
+
+	return children
+}
+
+// writeHeader writes the HELP and TYPE lines of the family.
+func (f *family[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter by a non-negative value.
+//
+// Parameters:
+//   - v: The amount to add. Negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+
+	addFloat(&c.bits, v)
+}
+
+// Value returns the current value of the counter.
+//
+// Returns:
+//   - The sum of all values added so far.
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	family[Counter]
+}
+
+// NewCounterVec creates a counter family and registers it.
+//
+// Parameters:
+//   - name: The metric name.
+//   - help: The help text.
+//   - labels: The label names.
+//
+// Returns:
+//   - A pointer to the new CounterVec.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{family[Counter]{
+		name:     name,
+		help:     help,
+		typ:      "counter",
+		labels:   labels,
+		create:   func() *Counter { return &Counter{} },
+		children: make(map[string]*child[Counter]),
+	}}
+	r.register(v)
+
+	return v
+}
+
+// With returns the counter for the label values, creating it on first use.
+// It panics if the number of values does not match the number of labels.
+//
+// Parameters:
+//   - values: The label values, in the order of the label names.
+//
+// Returns:
+//   - A pointer to the counter.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+
+	for _, c := range v.sorted() {
+		writeSample(w, v.name, v.labels, c.values, "", "", c.metric.Value())
+	}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+// Observe records a single observation.
+//
+// Parameters:
+//   - v: The observed value.
+func (h *Histogram) Observe(v float64) {
+	if i, _ := slices.BinarySearch(h.upper, v); i < len(h.upper) {
+		h.counts[i].Add(1)
+	}
+
+	h.count.Add(1)
+	addFloat(&h.sum, v)
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	family[Histogram]
+}
+
+// NewHistogramVec creates a histogram family and registers it. The buckets
+// must be sorted in increasing order; the +Inf bucket is implicit.
+//
+// Parameters:
+//   - name: The metric name.
+//   - help: The help text.
+//   - buckets: The upper bounds of the buckets.
+//   - labels: The label names.
+//
+// Returns:
+//   - A pointer to the new HistogramVec.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: %s buckets are not sorted", name))
+	}
+
+	upper := slices.Clone(buckets)
+	v := &HistogramVec{family[Histogram]{
+		name:   name,
+		help:   help,
+		typ:    "histogram",
+		labels: labels,
+		create: func() *Histogram {
+			return &Histogram{upper: upper, counts: make([]atomic.Uint64, len(upper))}
+		},
+		children: make(map[string]*child[Histogram]),
+	}}
+	r.register(v)
+
+	return v
+}
+
+// With returns the histogram for the label values, creating it on first use.
+// It panics if the number of values does not match the number of labels.
+//
+// Parameters:
+//   - values: The label values, in the order of the label names.
+//
+// Returns:
+//   - A pointer to the histogram.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+
+	for _, c := range v.sorted() {
+		h := c.metric
+		var cumulative uint64
+
+		for i, upper := range h.upper {
+			cumulative += h.counts[i].Load()
+			writeSample(w, v.name+"_bucket", v.labels, c.values, "le", formatFloat(upper), float64(cumulative))
+		}
+
+		count := h.count.Load()
+		writeSample(w, v.name+"_bucket", v.labels, c.values, "le", "+Inf", float64(count))
+		writeSample(w, v.name+"_sum", v.labels, c.values, "", "", math.Float64frombits(h.sum.Load()))
+		writeSample(w, v.name+"_count", v.labels, c.values, "", "", float64(count))
+	}
+}
+
+// addFloat atomically adds v to the float64 stored as bits.
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// writeSample writes one sample line. An extra label, such as "le" for
+// histogram buckets, is appended when extraName is not empty.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, l, values[i])
+		}
+
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+// writeLabel writes a name="value" pair with the value escaped.
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	w.WriteString(labelEscaper.Replace(value))
+	w.WriteByte('"')
+}
+
+// labelEscaper escapes label values as required by the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeHelp escapes help text as required by the text format.
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// formatFloat formats a sample value as expected by Prometheus.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
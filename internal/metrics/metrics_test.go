@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A test counter.", "kind")
+
+	c.With("b").Inc()
+	c.With("a").Add(2.5)
+	c.With("b").Inc()
+	c.With("a").Add(-1)
+
+	assert.Equal(t, 2.5, c.With("a").Value())
+	assert.Equal(t, 2.0, c.With("b").Value())
+
+	var out strings.Builder
+	_, err := r.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{kind="a"} 2.5
+test_total{kind="b"} 2
+`, out.String())
+}
+
+func TestCounterVecWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("plain_total", "No labels.").With().Inc()
+
+	var out strings.Builder
+	r.WriteTo(&out)
+	assert.Contains(t, out.String(), "\nplain_total 1\n")
+}
+
+func TestCounterVecLabelMismatch(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A test counter.", "a", "b")
+	assert.Panics(t, func() { c.With("only one") })
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "A test histogram.", []float64{0.1, 1}, "method")
+
+	h.With("get").Observe(0.05)
+	h.With("get").Observe(0.1)
+	h.With("get").Observe(0.5)
+	h.With("get").Observe(3)
+
+	var out strings.Builder
+	_, err := r.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP latency_seconds A test histogram.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="get",le="0.1"} 2
+latency_seconds_bucket{method="get",le="1"} 3
+latency_seconds_bucket{method="get",le="+Inf"} 4
+latency_seconds_sum{method="get"} 3.65
+latency_seconds_count{method="get"} 4
+`, out.String())
+}
+
+func TestHistogramVecUnsortedBuckets(t *testing.T) {
+	r := NewRegistry()
+	assert.Panics(t, func() { r.NewHistogramVec("bad", "Unsorted.", []float64{1, 0.1}) })
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("escaped_total", "Back\\slash\nnewline.", "v").With("a\"b\\c\nd").Inc()
+
+	var out strings.Builder
+	r.WriteTo(&out)
+	assert.Equal(t, `# HELP escaped_total Back\\slash\nnewline.
+# TYPE escaped_total counter
+escaped_total{v="a\"b\\c\nd"} 1
+`, out.String())
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("served_total", "Served.").With().Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "served_total 1\n")
+}
@@ -0,0 +1,175 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package stats implements Pearson's chi-square goodness-of-fit test, which
+// pgb stats uses to tell whether the outcomes of an oracle follow their
+// expected chances. P-values come from the regularized incomplete gamma
+// function, evaluated in float64.
+package stats
+
+import (
+	"errors"
+	"math"
+)
+
+// Result is the outcome of a chi-square goodness-of-fit test.
+//
+// Fields:
+//   - Statistic: Pearson's chi-square statistic.
+//   - DF: The degrees of freedom, one less than the number of categories with
+//     a non-zero expected count.
+//   - P: The probability of a statistic at least this large if the observed
+//     counts follow the expected distribution.
+type Result struct {
+	Statistic float64
+	DF        int
+	P         float64
+}
+
+// ChiSquare tests observed category counts against expected probabilities.
+// The probabilities are normalized, so they only need to be proportional to
+// the expected counts.
+//
+// Parameters:
+//   - observed: The number of samples in each category.
+//   - expected: The expected probability of each category.
+//
+// Returns:
+//   - The test result.
+//   - An error if the slices differ in length, a probability is negative, no
+//     samples were observed, or a sample fell into a category that is
+//     expected never to occur.
+func ChiSquare(observed []uint64, expected []float64) (Result, error) {
+	if len(observed) != len(expected) {
+		return Result{}, errors.New("observed and expected differ in length")
+	}
+
+	var n uint64
+	var total float64
+
+	for i, p := range expected {
+		if p < 0 || math.IsNaN(p) {
+			return Result{}, errors.New("negative expected probability")
+		}
+
+		n += observed[i]
+		total += p
+	}
+
+	if n == 0 || total == 0 {
+		return Result{}, errors.New("no samples")
+	}
+
+	var res Result
+
+	for i, p := range expected {
+		if p == 0 {
+			if observed[i] != 0 {
+				return Result{}, errors.New("observed a category expected never to occur")
+			}
+
+			continue
+		}
+
+		e := float64(n) * p / total
+		d := float64(observed[i]) - e
+		res.Statistic += d * d / e
+		res.DF++
+	}
+
+	res.DF--
+	res.P = ChiSquareSF(res.Statistic, res.DF)
+
+	return res, nil
+}
+
+// ChiSquareSF is the survival function of the chi-square distribution.
+//
+// Parameters:
+//   - x: The value of the statistic.
+//   - df: The degrees of freedom.
+//
+// Returns:
+//   - The probability of a value of at least x, or 1 if df is not positive.
+func ChiSquareSF(x float64, df int) float64 {
+	if df <= 0 || x <= 0 {
+		return 1
+	}
+
+	return gammaQ(float64(df)/2, x/2)
+}
+
+// Parameters of the incomplete gamma function evaluation.
+const (
+	gammaIterations = 1000
+	gammaEpsilon    = 1e-15
+	gammaTiny       = 1e-300
+)
+
+// gammaQ returns the regularized upper incomplete gamma function Q(a, x),
+// using its series expansion for x < a+1 and its continued fraction
+// otherwise.
+func gammaQ(a, x float64) float64 {
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(a*math.Log(x) - x - lg)
+
+	if x < a+1 {
+		sum := 1 / a
+		term := sum
+
+		for n := 1; n < gammaIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+
+			if math.Abs(term) < math.Abs(sum)*gammaEpsilon {
+				break
+			}
+		}
+
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	// Modified Lentz's method.
+	b := x + 1 - a
+	c := 1 / gammaTiny
+	d := 1 / b
+	h := d
+
+	for n := 1; n < gammaIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+
+		d = an*d + b
+		if math.Abs(d) < gammaTiny {
+			d = gammaTiny
+		}
+
+		c = b + an/c
+		if math.Abs(c) < gammaTiny {
+			c = gammaTiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < gammaEpsilon {
+			break
+		}
+	}
+
+	return h * prefix
+}
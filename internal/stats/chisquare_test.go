@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChiSquareSF(t *testing.T) {
+	// Critical values from standard chi-square tables.
+	tests := []struct {
+		x    float64
+		df   int
+		want float64
+	}{
+		{x: 3.841459, df: 1, want: 0.05},
+		{x: 6.634897, df: 1, want: 0.01},
+		{x: 5.991465, df: 2, want: 0.05},
+		{x: 18.307038, df: 10, want: 0.05},
+		{x: 2.155856, df: 10, want: 0.995},
+		{x: 9.342, df: 10, want: 0.5},
+		{x: 124.342113, df: 100, want: 0.05},
+		{x: 0, df: 3, want: 1},
+		{x: 5, df: 0, want: 1},
+	}
+
+	for _, tt := range tests {
+		assert.InDelta(t, tt.want, ChiSquareSF(tt.x, tt.df), 1e-4, "x=%v df=%v", tt.x, tt.df)
+	}
+}
+
+func TestChiSquare(t *testing.T) {
+	res, err := ChiSquare([]uint64{50, 30, 20}, []float64{0.5, 0.3, 0.2})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, res.Statistic)
+	assert.Equal(t, 2, res.DF)
+	assert.Equal(t, 1.0, res.P)
+
+	// Expected probabilities are normalized and zero ones are ignored.
+	res, err = ChiSquare([]uint64{60, 40, 0}, []float64{1, 1, 0})
+	assert.NoError(t, err)
+	assert.InDelta(t, 4.0, res.Statistic, 1e-12)
+	assert.Equal(t, 1, res.DF)
+	assert.InDelta(t, 0.0455, res.P, 1e-4)
+}
+
+func TestChiSquareErrors(t *testing.T) {
+	_, err := ChiSquare([]uint64{1}, []float64{0.5, 0.5})
+	assert.Error(t, err)
+
+	_, err = ChiSquare([]uint64{0, 0}, []float64{0.5, 0.5})
+	assert.Error(t, err)
+
+	_, err = ChiSquare([]uint64{1, 1}, []float64{-1, 2})
+	assert.Error(t, err)
+
+	_, err = ChiSquare([]uint64{1, 1}, []float64{1, 0})
+	assert.Error(t, err)
+}
@@ -0,0 +1,222 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+//go:embed data/lingqian.yaml
+var lingqianData []byte
+
+// lingqianStick is a numbered fortune stick of a temple set.
+//
+// Fields:
+//   - Number: The number of the stick, counted from 1.
+//   - Grade: How auspicious the stick is, such as "上上" or "下下".
+//   - Title: The title of the stick, usually the story it alludes to. It is
+//     optional.
+//   - Poem: The lines of the poem.
+//   - Interpretation: The interpretation of the poem.
+type lingqianStick struct {
+	Number         int      `yaml:"number"`
+	Grade          string   `yaml:"grade"`
+	Title          string   `yaml:"title"`
+	Poem           []string `yaml:"poem"`
+	Interpretation string   `yaml:"interpretation"`
+}
+
+// lingqianSet is the set of fortune sticks of a temple.
+//
+// Fields:
+//   - Name: The name of the set, shown above the stick drawn. It is
+//     optional.
+//   - Sticks: The sticks in the order of their numbers.
+type lingqianSet struct {
+	Name   string          `yaml:"name"`
+	Sticks []lingqianStick `yaml:"sticks"`
+}
+
+// parseLingqianSet parses and validates a set of fortune sticks.
+//
+// Parameters:
+//   - data: The set as YAML, a name and a list of sticks.
+//
+// Returns:
+//   - A pointer to the set.
+//   - An error if the set is malformed, has no sticks, its sticks are not
+//     numbered from 1 in order, or a stick has no grade, poem or
+//     interpretation.
+func parseLingqianSet(data []byte) (*lingqianSet, error) {
+	var set lingqianSet
+
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	if len(set.Sticks) == 0 {
+		return nil, errors.New("no sticks")
+	}
+
+	for i, stick := range set.Sticks {
+		if stick.Number != i+1 {
+			return nil, fmt.Errorf("stick %d is numbered %d", i+1, stick.Number)
+		}
+
+		if stick.Grade == "" || stick.Interpretation == "" {
+			return nil, fmt.Errorf("stick %d is missing a grade or interpretation", stick.Number)
+		}
+
+		if len(stick.Poem) == 0 || strings.TrimSpace(strings.Join(stick.Poem, "")) == "" {
+			return nil, fmt.Errorf("stick %d has no poem", stick.Number)
+		}
+	}
+
+	return &set, nil
+}
+
+// loadLingqianSet reads a set of fortune sticks from a file.
+//
+// Parameters:
+//   - path: The path of the YAML file.
+//
+// Returns:
+//   - A pointer to the set.
+//   - An error if the file cannot be read or does not hold a valid set.
+func loadLingqianSet(path string) (*lingqianSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LINGQIAN_FILE: %w", err)
+	}
+
+	set, err := parseLingqianSet(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LINGQIAN_FILE %q: %w", path, err)
+	}
+
+	return set, nil
+}
+
+// defaultLingqian is the embedded set of 100 fortune sticks, used unless
+// LINGQIAN_FILE names another.
+var defaultLingqian = mustParse(parseLingqianSet, lingqianData)
+
+// lingqianNumber and lingqianInterpretation frame the number of a stick and
+// its interpretation in an answer.
+const (
+	lingqianNumber         = "\n第"
+	lingqianInterpretation = "\n解曰: "
+)
+
+// drawLingqian draws one stick of the set in the settings of an
+// UpdateContext for its query.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the query and random
+//     number generator.
+//
+// Returns:
+//   - A string with the query, the name of the set, the number, grade and
+//     title of the stick, the lines of its poem and its interpretation.
+func drawLingqian(ctx *UpdateContext) string {
+	var b builder
+
+	set := ctx.Settings.lingqian
+	stick := set.Sticks[ctx.Rand.Intn(len(set.Sticks))]
+
+	b.WriteStrings("所求事项: ", *ctx.Query)
+
+	if set.Name != "" {
+		b.WriteStrings("\n", set.Name)
+	}
+
+	b.WriteStrings(lingqianNumber, strconv.Itoa(stick.Number), "签 ", stick.Grade)
+
+	if stick.Title != "" {
+		b.WriteStrings(" ", stick.Title)
+	}
+
+	for _, line := range stick.Poem {
+		b.WriteStrings("\n", line)
+	}
+
+	b.WriteStrings(lingqianInterpretation, stick.Interpretation)
+
+	return b.String()
+}
+
+// lingqianOracle draws a numbered fortune stick from a temple set.
+type lingqianOracle struct{}
+
+func (lingqianOracle) ID() string { return "lingqian" }
+
+func (lingqianOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "灵签"
+	}
+
+	return "Fortune stick"
+}
+
+func (lingqianOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "求一支灵签，附签诗与解曰"
+	}
+
+	return "Draw a fortune stick with its poem"
+}
+
+func (lingqianOracle) Consult(ctx *UpdateContext) string {
+	return drawLingqian(ctx)
+}
+
+// Expected gives every stick of the current set the same chance.
+func (lingqianOracle) Expected(string) []Outcome {
+	sticks := currentSettings().lingqian.Sticks
+
+	outcomes := make([]Outcome, len(sticks))
+	for i, stick := range sticks {
+		outcomes[i] = Outcome{Label: strconv.Itoa(stick.Number), P: 1 / float64(len(sticks))}
+	}
+
+	return outcomes
+}
+
+// Outcome reads the number of the stick from the first line of the form
+// "第27签 ...", skipping the name of the set, which may start with 第 too.
+func (lingqianOracle) Outcome(_, answer string) string {
+	for {
+		_, rest, ok := strings.Cut(answer, lingqianNumber)
+		if !ok {
+			return ""
+		}
+
+		number, _, ok := strings.Cut(rest, "签 ")
+		if _, err := strconv.Atoi(number); ok && err == nil {
+			return number
+		}
+
+		answer = rest
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// twoSticks is a minimal valid set of fortune sticks.
+const twoSticks = `name: 测试签
+sticks:
+  - {number: 1, grade: 上上, poem: [甲], interpretation: 吉}
+  - {number: 2, grade: 下下, title: 乙签, poem: [乙, 丙], interpretation: 凶}
+`
+
+// writeLingqianFile writes a set of fortune sticks into a temporary
+// directory.
+func writeLingqianFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "lingqian.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestDefaultLingqian(t *testing.T) {
+	set, err := parseLingqianSet(lingqianData)
+	require.NoError(t, err)
+	require.Len(t, set.Sticks, 100)
+
+	grades := map[string]bool{}
+	titles := map[string]bool{}
+
+	for _, stick := range set.Sticks {
+		grades[stick.Grade] = true
+
+		assert.False(t, titles[stick.Title], stick.Title)
+		titles[stick.Title] = true
+
+		assert.Len(t, stick.Poem, 4, stick.Number)
+	}
+
+	assert.Equal(t, map[string]bool{"上上": true, "上吉": true, "中吉": true, "中平": true, "中下": true, "下下": true}, grades)
+}
+
+func TestParseLingqianSetErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"malformed", "sticks: [\n", "yaml"},
+		{"empty", "name: 空\n", "no sticks"},
+		{"numbering", "sticks:\n  - {number: 2, grade: 上上, poem: [甲], interpretation: 吉}\n", "stick 1 is numbered 2"},
+		{"no grade", "sticks:\n  - {number: 1, poem: [甲], interpretation: 吉}\n", "missing a grade"},
+		{"no interpretation", "sticks:\n  - {number: 1, grade: 上上, poem: [甲]}\n", "missing a grade or interpretation"},
+		{"no poem", "sticks:\n  - {number: 1, grade: 上上, poem: [\"\"], interpretation: 吉}\n", "no poem"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseLingqianSet([]byte(tt.content))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadLingqianSet(t *testing.T) {
+	set, err := loadLingqianSet(writeLingqianFile(t, twoSticks))
+	require.NoError(t, err)
+	assert.Equal(t, "测试签", set.Name)
+	assert.Len(t, set.Sticks, 2)
+
+	_, err = loadLingqianSet(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "LINGQIAN_FILE")
+
+	_, err = loadLingqianSet(writeLingqianFile(t, "name: 空\n"))
+	assert.ErrorContains(t, err, "no sticks")
+}
+
+func TestConfigValidateLingqianFile(t *testing.T) {
+	conf := testConfig(t)
+
+	conf.LingqianFile = writeLingqianFile(t, twoSticks)
+	assert.NoError(t, conf.Validate())
+
+	conf.LingqianFile = writeLingqianFile(t, "name: 空\n")
+	assert.ErrorContains(t, conf.Validate(), "no sticks")
+}
+
+func TestSettingsLingqian(t *testing.T) {
+	s, err := newSettings(&Config{})
+	require.NoError(t, err)
+	assert.Same(t, defaultLingqian, s.lingqian)
+
+	s, err = newSettings(&Config{LingqianFile: writeLingqianFile(t, twoSticks)})
+	require.NoError(t, err)
+	assert.Len(t, s.lingqian.Sticks, 2)
+
+	_, err = newSettings(&Config{LingqianFile: filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+}
+
+func TestDrawLingqian(t *testing.T) {
+	s, err := newSettings(&Config{LingqianFile: writeLingqianFile(t, twoSticks)})
+	require.NoError(t, err)
+
+	prev := live.Load()
+	t.Cleanup(func() { live.Store(prev) })
+	live.Store(s)
+
+	query := "问题"
+	answers := map[string]bool{}
+
+	for seed := range int64(20) {
+		ctx := &UpdateContext{Query: &query, Rand: rand.New(rand.NewSource(seed)), Settings: s}
+		answers[drawLingqian(ctx)] = true
+	}
+
+	assert.Equal(t, map[string]bool{
+		"所求事项: 问题\n测试签\n第1签 上上\n甲\n解曰: 吉":       true,
+		"所求事项: 问题\n测试签\n第2签 下下 乙签\n乙\n丙\n解曰: 凶": true,
+	}, answers)
+
+	o := lingqianOracle{}
+	assert.Equal(t, []Outcome{{Label: "1", P: 0.5}, {Label: "2", P: 0.5}}, o.Expected(query))
+
+	for answer := range answers {
+		assert.Contains(t, []string{"1", "2"}, o.Outcome(query, answer))
+	}
+}
+
+func TestLingqianOutcome(t *testing.T) {
+	o := lingqianOracle{}
+
+	assert.Len(t, o.Expected(""), 100)
+	assert.Equal(t, "27", o.Outcome("", "所求事项: q\n灵签百首\n第27签 中平 守口如瓶\n"+strings.Repeat("诗\n", 4)+"解曰: 解"))
+	assert.Equal(t, "3", o.Outcome("", "所求事项: q\n第一山灵签\n第3签 上上\n诗\n解曰: 解"))
+	assert.Empty(t, o.Outcome("", "所求事项: q"))
+}
@@ -0,0 +1,296 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Log output formats supported by Config.LogFormat.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// parseLogLevel parses a log level name such as "debug", "info", "warn" or
+// "error", case-insensitively.
+//
+// Parameters:
+//   - name: The level name.
+//
+// Returns:
+//   - The parsed slog.Level.
+//   - An error if the name is not a known level.
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid LOG_LEVEL %q: %w", name, err)
+	}
+
+	return level, nil
+}
+
+// redactSecrets returns a slog.HandlerOptions.ReplaceAttr function that
+// replaces every occurrence of the secrets in string and error values,
+// including the message, with "***".
+//
+// Parameters:
+//   - secrets: The values that must never be logged. Empty values are
+//     ignored.
+//
+// Returns:
+//   - The ReplaceAttr function, or nil if there is nothing to redact.
+func redactSecrets(secrets ...string) func([]string, slog.Attr) slog.Attr {
+	var pairs []string
+	for _, s := range secrets {
+		if s != "" {
+			pairs = append(pairs, s, "***")
+		}
+	}
+
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	r := strings.NewReplacer(pairs...)
+
+	return func(_ []string, a slog.Attr) slog.Attr {
+		switch v := a.Value.Any().(type) {
+		case string:
+			a.Value = slog.StringValue(r.Replace(v))
+		case error:
+			a.Value = slog.StringValue(r.Replace(v.Error()))
+		}
+
+		return a
+	}
+}
+
+// newLogger creates a logger writing records of at least the given level in
+// the given format.
+//
+// Parameters:
+//   - w: The writer receiving the log records.
+//   - level: The minimum level of records to write.
+//   - format: Either LogFormatJSON or LogFormatText.
+//   - secrets: Values that are replaced by "***" wherever they appear.
+//
+// Returns:
+//   - A pointer to the new slog.Logger.
+//   - An error if the format is unknown.
+func newLogger(w io.Writer, level slog.Level, format string, secrets ...string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactSecrets(secrets...),
+	}
+
+	switch format {
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case LogFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q: must be %q or %q", format, LogFormatJSON, LogFormatText)
+	}
+}
+
+// setupLogging installs the logger described by the configuration as the
+// default logger. Debug mode lowers the level to debug so that the output of
+// the bot library is not filtered out. The bot token and webhook secret are
+// redacted from every record, since the library's debug output includes
+// request URLs, which contain the token.
+//
+// Parameters:
+//   - conf: The application configuration.
+//
+// Returns:
+//   - An error if the log level or format is invalid.
+func setupLogging(conf *Config) error {
+	level, err := parseLogLevel(conf.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	if conf.Debug {
+		level = slog.LevelDebug
+	}
+
+	logger, err := newLogger(os.Stderr, level, conf.LogFormat, conf.Token, conf.WebhookSecret, conf.SeedSecret)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
+
+// loggerKey is the context key under which the per-update logger is stored.
+type loggerKey struct{}
+
+// withLogger returns a copy of the context carrying the logger.
+//
+// Parameters:
+//   - ctx: The parent context.
+//   - l: The logger to attach.
+//
+// Returns:
+//   - The derived context.
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger attached to the context, or the default
+// logger if there is none.
+//
+// Parameters:
+//   - ctx: The context to look up.
+//
+// Returns:
+//   - A pointer to the slog.Logger to use.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
+
+// logUserAlgorithm names the keyed digest of user IDs in logs. It is hashed
+// before the ID, so the digests never coincide with answer seeds derived from
+// the same secret.
+const logUserAlgorithm = "pgb/log-user/v1"
+
+// logUserKey keys the user digests in logs while no seed secret is set. It is
+// random, so without SEED_SECRET digests only correlate the log lines of one
+// process.
+var logUserKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	return key
+}()
+
+// userHashKey returns the key of the user digests in logs: the seed secret in
+// use, or logUserKey without one.
+func userHashKey() []byte {
+	if key := currentSettings().seedSecret; len(key) > 0 {
+		return key
+	}
+
+	return logUserKey
+}
+
+// hashUserID returns a short, stable pseudonym of a user ID so that log lines
+// of the same user can be correlated without recording the ID itself. The
+// digest is keyed, since Telegram user IDs are few enough that an unkeyed one
+// could be reversed by trying them all.
+//
+// Parameters:
+//   - key: The secret key of the digest.
+//   - userID: The Telegram user ID.
+//
+// Returns:
+//   - The first 8 bytes of the HMAC-SHA256 of the ID, hex-encoded.
+func hashUserID(key []byte, userID uint64) string {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(logUserAlgorithm))
+	_ = binary.Write(h, binary.LittleEndian, userID)
+
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// updateLogger derives a logger annotated with the update ID and, for inline
+// queries and messages, the hashed user ID and locale of the sender.
+//
+// Parameters:
+//   - l: The base logger.
+//   - update: The update being processed.
+//
+// Returns:
+//   - A pointer to the annotated slog.Logger.
+func updateLogger(l *slog.Logger, update *models.Update) *slog.Logger {
+	l = l.With(slog.Int64("update_id", update.ID))
+
+	var from *models.User
+	switch {
+	case update.InlineQuery != nil:
+		from = update.InlineQuery.From
+	case update.Message != nil:
+		from = update.Message.From
+	}
+
+	if from != nil {
+		l = l.With(
+			slog.String("user", hashUserID(userHashKey(), getUserID(from))),
+			slog.String("locale", getUserLocale(from)),
+		)
+	}
+
+	return l
+}
+
+// logUpdate is a bot middleware that attaches a per-update logger to the
+// handler context.
+//
+// Parameters:
+//   - next: The handler to wrap.
+//
+// Returns:
+//   - The wrapped handler.
+func logUpdate(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		next(withLogger(ctx, updateLogger(slog.Default(), update)), b, update)
+	}
+}
+
+// botErrorsHandler routes errors reported by the bot library to the default
+// logger.
+//
+// Parameters:
+//   - err: The error reported by the library.
+func botErrorsHandler(err error) {
+	slog.Error("telegram bot error", slog.Any("error", err))
+}
+
+// botDebugHandler routes debug messages of the bot library to the default
+// logger at debug level.
+//
+// Parameters:
+//   - format: The printf-style format string.
+//   - args: The format arguments.
+func botDebugHandler(format string, args ...any) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	slog.Debug(strings.TrimSpace(fmt.Sprintf(format, args...)), slog.String("source", "telegram"))
+}
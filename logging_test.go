@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{name: "debug", expected: slog.LevelDebug},
+		{name: "INFO", expected: slog.LevelInfo},
+		{name: "warn", expected: slog.LevelWarn},
+		{name: "error", expected: slog.LevelError},
+		{name: "verbose", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := parseLogLevel(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	l, err := newLogger(&buf, slog.LevelInfo, LogFormatJSON)
+	assert.NoError(t, err)
+	l.Debug("hidden")
+	l.Info("shown", slog.String("k", "v"))
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "shown", record["msg"])
+	assert.Equal(t, "v", record["k"])
+
+	buf.Reset()
+	l, err = newLogger(&buf, slog.LevelDebug, LogFormatText)
+	assert.NoError(t, err)
+	l.Debug("shown")
+	assert.Contains(t, buf.String(), "msg=shown")
+
+	_, err = newLogger(&buf, slog.LevelInfo, "xml")
+	assert.Error(t, err)
+}
+
+func TestHashUserID(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	assert.Len(t, hashUserID(key, 42), 16)
+	assert.Equal(t, hashUserID(key, 42), hashUserID(key, 42))
+	assert.NotEqual(t, hashUserID(key, 42), hashUserID(key, 43))
+	assert.NotEqual(t, hashUserID(key, 42), hashUserID([]byte("fedcba9876543210"), 42))
+	assert.NotContains(t, hashUserID(key, 12345), "12345")
+
+	// An unkeyed digest of the ID would be computable by anyone.
+	var id [8]byte
+	binary.LittleEndian.PutUint64(id[:], 42)
+	sum := sha256.Sum256(id[:])
+	assert.NotEqual(t, hex.EncodeToString(sum[:8]), hashUserID(key, 42))
+}
+
+func TestUserHashKey(t *testing.T) {
+	defer live.Store(live.Load())
+
+	live.Store(testSettings(t))
+	assert.Equal(t, logUserKey, userHashKey())
+
+	s := testSettings(t)
+	s.seedSecret = []byte("0123456789abcdef")
+	live.Store(s)
+	assert.Equal(t, s.seedSecret, userHashKey())
+}
+
+func TestLogUpdate(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := newLogger(&buf, slog.LevelInfo, LogFormatJSON)
+
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(l)
+
+	update := &models.Update{
+		ID: 7,
+		InlineQuery: &models.InlineQuery{
+			From: &models.User{ID: 42, LanguageCode: "en"},
+		},
+	}
+
+	h := logUpdate(func(ctx context.Context, _ *bot.Bot, _ *models.Update) {
+		loggerFrom(ctx).Info("handled")
+	})
+	h(context.Background(), nil, update)
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, float64(7), record["update_id"])
+	assert.Equal(t, hashUserID(userHashKey(), 42), record["user"])
+	assert.Equal(t, "en", record["locale"])
+}
+
+func TestUpdateLoggerMessage(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := newLogger(&buf, slog.LevelInfo, LogFormatJSON)
+
+	updateLogger(l, &models.Update{
+		ID: 8,
+		Message: &models.Message{
+			From: &models.User{ID: 42, LanguageCode: "zh"},
+			Text: "/divine 问题",
+		},
+	}).Info("handled")
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, float64(8), record["update_id"])
+	assert.Equal(t, hashUserID(userHashKey(), 42), record["user"])
+	assert.Equal(t, "zh", record["locale"])
+
+	// Channel posts have no sender.
+	buf.Reset()
+	updateLogger(l, &models.Update{ID: 9, Message: &models.Message{}}).Info("handled")
+	assert.NotContains(t, buf.String(), `"user"`)
+}
+
+func TestLoggerFromDefault(t *testing.T) {
+	assert.Same(t, slog.Default(), loggerFrom(context.Background()))
+}
+
+func TestNewLoggerRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	token := "123456:secret-token"
+
+	l, err := newLogger(&buf, slog.LevelDebug, LogFormatText, token, "")
+	assert.NoError(t, err)
+
+	l.Debug("request url: https://api.telegram.org/bot" + token + "/getMe")
+	l.Error("failed", slog.Any("error", errors.New("post bot"+token+": timeout")), slog.String("url", token))
+
+	assert.NotContains(t, buf.String(), token)
+	assert.Contains(t, buf.String(), "bot***/getMe")
+	assert.Contains(t, buf.String(), "timeout")
+}
+
+func TestRedactSecretsNothingToRedact(t *testing.T) {
+	assert.Nil(t, redactSecrets("", ""))
+}
@@ -0,0 +1,145 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YukariExpress/pgb/internal/metrics"
+)
+
+// metricsPath is the path of the Prometheus metrics endpoint.
+const metricsPath = "/metrics"
+
+// registry holds all metrics exposed on the metrics endpoint.
+var registry = metrics.NewRegistry()
+
+// Metrics exposed by pgb.
+var (
+	inlineQueriesTotal = registry.NewCounterVec(
+		"pgb_inline_queries_total",
+		"Inline queries received, by user locale.",
+		"locale",
+	)
+	oracleResultsTotal = registry.NewCounterVec(
+		"pgb_oracle_results_total",
+		"Inline query results and command replies sent, by oracle.",
+		"oracle",
+	)
+	divineOmensTotal = registry.NewCounterVec(
+		"pgb_divine_omens_total",
+		"Omens of the divinations sent.",
+		"omen",
+	)
+	divineMultipliersTotal = registry.NewCounterVec(
+		"pgb_divine_multipliers_total",
+		"Multipliers of the divinations sent with a non-neutral omen.",
+		"multiplier",
+	)
+	telegramRequestDuration = registry.NewHistogramVec(
+		"pgb_telegram_request_duration_seconds",
+		"Latency of Telegram Bot API requests, by method.",
+		metrics.DefBuckets,
+		"method",
+	)
+	telegramRequestErrorsTotal = registry.NewCounterVec(
+		"pgb_telegram_request_errors_total",
+		"Failed Telegram Bot API requests, by method.",
+		"method",
+	)
+	webhookRequestsTotal = registry.NewCounterVec(
+		"pgb_webhook_requests_total",
+		"Webhook HTTP requests, by response status code.",
+		"code",
+	)
+)
+
+// metricLabel maps an empty outcome, such as the neutral multiplier, to a
+// readable label value.
+//
+// Parameters:
+//   - s: The outcome string.
+//
+// Returns:
+//   - The outcome, or "none" if it is empty.
+func metricLabel(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	return s
+}
+
+// recordAnswer counts an answer sent to a user, by oracle and, for oracles
+// that are Recorders, by outcome. It is called once Telegram has accepted the
+// answer, so answers that are only computed, such as those of pgb stats or
+// those hidden by a keyword, and answers that failed to send are not counted.
+//
+// Parameters:
+//   - a: The answer sent.
+func recordAnswer(a answer) {
+	oracleResultsTotal.With(a.Oracle.ID()).Inc()
+
+	if r, ok := a.Oracle.(Recorder); ok {
+		r.Record(a.Context)
+	}
+}
+
+// observeTelegramRequest records the latency and outcome of a Telegram Bot API
+// request.
+//
+// Parameters:
+//   - method: The Bot API method name.
+//   - start: The time the request was started.
+//   - err: The error returned by the request, if any.
+func observeTelegramRequest(method string, start time.Time, err error) {
+	telegramRequestDuration.With(method).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		telegramRequestErrorsTotal.With(method).Inc()
+	}
+}
+
+// statusRecorder remembers the status code written through a
+// http.ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// instrumentWebhook wraps the webhook handler to count requests by status
+// code.
+//
+// Parameters:
+//   - next: The webhook handler.
+//
+// Returns:
+//   - The wrapped handler.
+func instrumentWebhook(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, req)
+		webhookRequestsTotal.With(strconv.Itoa(rec.code)).Inc()
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricLabel(t *testing.T) {
+	assert.Equal(t, "none", metricLabel(""))
+	assert.Equal(t, "大", metricLabel("大"))
+}
+
+func TestInstrumentWebhook(t *testing.T) {
+	ok := webhookRequestsTotal.With("200")
+	denied := webhookRequestsTotal.With("403")
+	okBefore, deniedBefore := ok.Value(), denied.Value()
+
+	h := instrumentWebhook(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/denied" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/denied", nil))
+
+	assert.Equal(t, okBefore+1, ok.Value())
+	assert.Equal(t, deniedBefore+1, denied.Value())
+}
+
+func TestObserveTelegramRequest(t *testing.T) {
+	errors := telegramRequestErrorsTotal.With("testMethod")
+
+	observeTelegramRequest("testMethod", time.Now(), nil)
+	assert.Equal(t, 0.0, errors.Value())
+
+	observeTelegramRequest("testMethod", time.Now(), assert.AnError)
+	assert.Equal(t, 1.0, errors.Value())
+}
+
+func TestRecordAnswer(t *testing.T) {
+	omens := func() float64 {
+		return divineOmensTotal.With("吉").Value() +
+			divineOmensTotal.With("凶").Value() +
+			divineOmensTotal.With("尚可").Value()
+	}
+	results := oracleResultsTotal.With("divine")
+	before, resultsBefore := omens(), results.Value()
+
+	// Consulting alone, as pgb stats does, counts nothing.
+	query := "question"
+	ctx := &UpdateContext{Rand: newRand([]uint64{2}), Query: &query, Settings: currentSettings()}
+	text := divine(ctx)
+	assert.Equal(t, before, omens())
+
+	recordAnswer(answer{Oracle: divineOracle{}, Text: text, Context: ctx})
+	assert.Equal(t, before+1, omens())
+	assert.Equal(t, resultsBefore+1, results.Value())
+
+	// The outcome is recorded as drawn, whatever the text reads.
+	good, none := divineOmensTotal.With("吉"), divineMultipliersTotal.With("none")
+	goodBefore, noneBefore := good.Value(), none.Value()
+
+	ctx = &UpdateContext{Divination: &divination{Omen: "吉"}}
+	recordAnswer(answer{Oracle: divineOracle{}, Text: "所求事项: q\n结果: 吉", Context: ctx})
+	assert.Equal(t, goodBefore+1, good.Value())
+	assert.Equal(t, noneBefore+1, none.Value())
+}
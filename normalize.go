@@ -0,0 +1,116 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Query normalization steps accepted by newQueryNormalizer. They are always
+// applied in this order, whatever the order they are configured in.
+const (
+	normalizeNFKC        = "nfkc"
+	normalizeWhitespace  = "whitespace"
+	normalizePunctuation = "punctuation"
+	normalizeCase        = "case"
+)
+
+// normalizeSteps lists the normalization steps in the order they are applied.
+var normalizeSteps = []string{
+	normalizeNFKC,
+	normalizeWhitespace,
+	normalizePunctuation,
+	normalizeCase,
+}
+
+// defaultQueryNormalizer applies every normalization step.
+var defaultQueryNormalizer, _ = newQueryNormalizer(normalizeSteps)
+
+// queryNormalizer maps trivially different queries, such as "明天会下雨吗" and
+// "明天会下雨吗？ ", to the same text before they are seeded, so that users
+// cannot re-roll an answer by retyping the query. It is only used by seed
+// schemes that normalize queries, and the normalized text is never shown.
+type queryNormalizer struct {
+	steps map[string]bool
+}
+
+// newQueryNormalizer creates a normalizer applying the given steps:
+//   - nfkc: Unicode NFKC normalization, which maps full-width letters and
+//     punctuation to their usual forms.
+//   - whitespace: Trimming and collapsing runs of whitespace into one space.
+//   - punctuation: Stripping trailing punctuation.
+//   - case: Unicode case folding.
+//
+// Parameters:
+//   - steps: The names of the steps to apply.
+//
+// Returns:
+//   - A pointer to the new queryNormalizer.
+//   - An error if a step is unknown or listed twice.
+func newQueryNormalizer(steps []string) (*queryNormalizer, error) {
+	n := &queryNormalizer{steps: make(map[string]bool, len(steps))}
+
+	for _, step := range steps {
+		if !slices.Contains(normalizeSteps, step) {
+			return nil, fmt.Errorf("unknown step %q", step)
+		}
+
+		if n.steps[step] {
+			return nil, fmt.Errorf("step %q listed twice", step)
+		}
+
+		n.steps[step] = true
+	}
+
+	return n, nil
+}
+
+// Normalize returns the normalized form of a query.
+//
+// Parameters:
+//   - q: The query as the user typed it.
+//
+// Returns:
+//   - The normalized query.
+func (n *queryNormalizer) Normalize(q string) string {
+	if n.steps[normalizeNFKC] {
+		q = norm.NFKC.String(q)
+	}
+
+	if n.steps[normalizeWhitespace] {
+		q = strings.Join(strings.Fields(q), " ")
+	}
+
+	if n.steps[normalizePunctuation] {
+		q = strings.TrimRightFunc(q, func(r rune) bool {
+			return unicode.IsPunct(r) || unicode.IsSpace(r)
+		})
+	}
+
+	if n.steps[normalizeCase] {
+		// A Caser keeps state, so each call gets its own.
+		q = cases.Fold().String(q)
+	}
+
+	return q
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryNormalizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		query string
+		want  string
+	}{
+		{name: "no steps", query: " 明天会下雨吗？ ", want: " 明天会下雨吗？ "},
+		{name: "nfkc", steps: []string{normalizeNFKC}, query: "Ｗｉｌｌ　ｉｔ？", want: "Will it?"},
+		{name: "whitespace", steps: []string{normalizeWhitespace}, query: " a \t b\n\nc ", want: "a b c"},
+		{name: "punctuation", steps: []string{normalizePunctuation}, query: "明天会下雨吗？！ ", want: "明天会下雨吗"},
+		{name: "inner punctuation kept", steps: []string{normalizePunctuation}, query: "A, B or C?", want: "A, B or C"},
+		{name: "case", steps: []string{normalizeCase}, query: "Will It RAIN Straße", want: "will it rain strasse"},
+		{name: "all", steps: normalizeSteps, query: "  Ｗｉｌｌ　it RAIN tomorrow？!  ", want: "will it rain tomorrow"},
+		{name: "all chinese", steps: normalizeSteps, query: "明天会下雨吗？ ", want: "明天会下雨吗"},
+		{name: "only punctuation", steps: normalizeSteps, query: "？？？", want: ""},
+		{name: "order independent", steps: []string{normalizeCase, normalizeNFKC}, query: "ＡＢＣ", want: "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := newQueryNormalizer(tt.steps)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, n.Normalize(tt.query))
+		})
+	}
+}
+
+func TestNewQueryNormalizerErrors(t *testing.T) {
+	_, err := newQueryNormalizer([]string{"nfc"})
+	assert.Error(t, err)
+
+	_, err = newQueryNormalizer([]string{normalizeCase, normalizeCase})
+	assert.Error(t, err)
+}
+
+func TestSettingsQueryNormalization(t *testing.T) {
+	s, err := newSettings(&Config{SeedScheme: 3, QueryNormalization: normalizeSteps})
+	assert.NoError(t, err)
+	s.oracles = []Oracle{divineOracle{}, piaOracle{}}
+
+	a := consultOraclesAt(s, 42, "明天会下雨吗", "zh", statsStart)
+	b := consultOraclesAt(s, 42, "明天会下雨吗？ ", "zh", statsStart)
+
+	// The answer shows the query as typed but reads the same.
+	assert.Contains(t, b[0].Text, "明天会下雨吗？ \n")
+	_, ra, _ := cutLast(a[0].Text, divineResult)
+	_, rb, _ := cutLast(b[0].Text, divineResult)
+	assert.Equal(t, ra, rb)
+
+	// Earlier schemes keep hashing the query as typed.
+	s.seedScheme = seedSchemeV1{}
+	differs := false
+	for id := uint64(1); id <= 20 && !differs; id++ {
+		differs = consultOraclesAt(s, id, "明天会下雨吗", "zh", statsStart)[0].Text !=
+			consultOraclesAt(s, id, "明天会下雨吗？ ", "zh", statsStart)[0].Text
+	}
+	assert.True(t, differs)
+
+	_, err = newSettings(&Config{QueryNormalization: []string{"nfc"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,392 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Oracle produces one kind of answer to a user's query, such as a divination
+// or a pia. Each enabled oracle contributes one inline query result and one
+// bot command.
+type Oracle interface {
+	// ID returns the stable identifier of the oracle. It is used as the
+	// inline result ID, the bot command name and the key in the
+	// configuration, so it must be a valid command name.
+	ID() string
+
+	// Title returns the built-in title of the oracle's result for a locale.
+	Title(locale string) string
+
+	// Description returns a short explanation of the oracle for a locale,
+	// shown below the title of the inline result.
+	Description(locale string) string
+
+	// Consult turns an UpdateContext into the message text of the answer.
+	// It must draw random numbers only from ctx.Rand and in a fixed order.
+	Consult(ctx *UpdateContext) string
+}
+
+// QueryFilter is implemented by oracles that only answer some queries. An
+// oracle whose Accepts method returns false is skipped without being
+// consulted, so it draws nothing from its random number generator.
+type QueryFilter interface {
+	Accepts(query string) bool
+}
+
+// Distribution is implemented by oracles whose answers to a query fall into
+// a known set of outcomes with known chances, so that pgb stats can check the
+// outcomes the oracle actually produces against the expected ones.
+type Distribution interface {
+	// Expected returns every possible outcome of a query with its
+	// probability, in the order they are reported.
+	Expected(query string) []Outcome
+
+	// Outcome returns the label of the outcome an answer to a query falls
+	// into.
+	Outcome(query, answer string) string
+}
+
+// Outcome is a possible outcome of an oracle.
+//
+// Fields:
+// - Label: The name of the outcome.
+// - P: The probability of the outcome.
+type Outcome struct {
+	Label string
+	P     float64
+}
+
+// Recorder is implemented by oracles that export metrics about the outcomes
+// of their answers. Record is called with the UpdateContext of every answer
+// sent to a user, after the oracle was consulted with it.
+type Recorder interface {
+	Record(ctx *UpdateContext)
+}
+
+// Keyworded is implemented by oracles that have queries of their own. An
+// inline query that is exactly one of the keywords of an enabled oracle,
+// ignoring case and surrounding whitespace, shows only the results of the
+// oracles it is a keyword of.
+type Keyworded interface {
+	Keywords() []string
+}
+
+// Impersonal is implemented by oracles whose answers depend on nothing but
+// their window, not on the user, the locale or the query, so that everyone
+// gets the same answer throughout it. Inline results that all come from such
+// oracles are cached by Telegram for every user until the earliest of their
+// windows ends, as long as none of their titles or descriptions varies by
+// locale.
+type Impersonal interface {
+	Windowed
+	Impersonal()
+}
+
+// accepts reports whether an oracle answers a query.
+//
+// Parameters:
+//   - o: The oracle.
+//   - query: The query text.
+//
+// Returns:
+//   - false if the oracle is a QueryFilter rejecting the query, true otherwise.
+func accepts(o Oracle, query string) bool {
+	if f, ok := o.(QueryFilter); ok {
+		return f.Accepts(query)
+	}
+
+	return true
+}
+
+// isKeyword reports whether a query is one of the keywords of an oracle.
+//
+// Parameters:
+//   - o: The oracle.
+//   - query: The query text.
+//
+// Returns:
+//   - true if the oracle is Keyworded and the query, trimmed of whitespace,
+//     equals one of its keywords ignoring case.
+func isKeyword(o Oracle, query string) bool {
+	k, ok := o.(Keyworded)
+	if !ok {
+		return false
+	}
+
+	query = strings.TrimSpace(query)
+
+	return slices.ContainsFunc(k.Keywords(), func(keyword string) bool {
+		return strings.EqualFold(keyword, query)
+	})
+}
+
+// OracleRegistry holds the known oracles in registration order.
+type OracleRegistry struct {
+	byID  map[string]Oracle
+	order []Oracle
+}
+
+// NewOracleRegistry creates a registry holding the given oracles.
+//
+// Parameters:
+//   - oracles: The oracles to register, in their default order.
+//
+// Returns:
+//   - A pointer to the new OracleRegistry.
+func NewOracleRegistry(oracles ...Oracle) *OracleRegistry {
+	r := &OracleRegistry{byID: make(map[string]Oracle)}
+
+	for _, o := range oracles {
+		r.Register(o)
+	}
+
+	return r
+}
+
+// Register adds an oracle to the registry. It panics if an oracle with the
+// same ID is already registered, since that is a programming error.
+//
+// Parameters:
+//   - o: The oracle to register.
+func (r *OracleRegistry) Register(o Oracle) {
+	if _, ok := r.byID[o.ID()]; ok {
+		panic(fmt.Sprintf("oracle %q registered twice", o.ID()))
+	}
+
+	r.byID[o.ID()] = o
+	r.order = append(r.order, o)
+}
+
+// Get looks up an oracle by ID.
+//
+// Parameters:
+//   - id: The oracle ID.
+//
+// Returns:
+//   - The oracle, and whether it was found.
+func (r *OracleRegistry) Get(id string) (Oracle, bool) {
+	o, ok := r.byID[id]
+	return o, ok
+}
+
+// All returns the registered oracles in registration order.
+//
+// Returns:
+//   - A slice of all oracles. The caller must not modify it.
+func (r *OracleRegistry) All() []Oracle {
+	return r.order
+}
+
+// Select resolves a list of oracle IDs into oracles, keeping the order of the
+// list. An empty list selects all registered oracles in registration order.
+//
+// Parameters:
+//   - ids: The IDs of the enabled oracles.
+//
+// Returns:
+//   - The selected oracles.
+//   - An error if an ID is unknown or listed twice.
+func (r *OracleRegistry) Select(ids []string) ([]Oracle, error) {
+	if len(ids) == 0 {
+		return r.order, nil
+	}
+
+	selected := make([]Oracle, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+
+	for _, id := range ids {
+		o, ok := r.Get(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown oracle %q", id)
+		}
+
+		if seen[id] {
+			return nil, fmt.Errorf("oracle %q listed twice", id)
+		}
+
+		seen[id] = true
+		selected = append(selected, o)
+	}
+
+	return selected, nil
+}
+
+// oracles is the registry of all oracles built into pgb. The registration
+// order is the default order of the inline results.
+var oracles = NewOracleRegistry(
+	divineOracle{},
+	piaOracle{},
+	choiceOracle{},
+	diceOracle{},
+	tarotOracle{},
+	ichingOracle{},
+	lingqianOracle{},
+	xiaoliurenOracle{},
+	almanacOracle{},
+)
+
+// streamOf names the random number stream an oracle draws from. Every oracle
+// has a stream of its own, except pia, which continues the stream of divine
+// after the divination as it did before there were other oracles, so that the
+// answers of seed scheme 1 stay the same. The divination is drawn whether or
+// not divine is enabled, so pia does not depend on it.
+//
+// Parameters:
+//   - o: The oracle.
+//
+// Returns:
+//   - The ID of the oracle whose stream o draws from.
+func streamOf(o Oracle) string {
+	if o.ID() == "pia" {
+		return "divine"
+	}
+
+	return o.ID()
+}
+
+// divineOracle tells whether the matter in the query is auspicious.
+type divineOracle struct{}
+
+func (divineOracle) ID() string { return "divine" }
+
+func (divineOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "求签"
+	}
+
+	return "Divination"
+}
+
+func (divineOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "所求之事是吉是凶"
+	}
+
+	return "Is your matter auspicious?"
+}
+
+func (divineOracle) Consult(ctx *UpdateContext) string {
+	return divine(ctx)
+}
+
+// Expected combines the omen and multiplier tables in use. Combinations that
+// read the same, which only configured tables can produce, are merged.
+func (divineOracle) Expected(string) []Outcome {
+	s := currentSettings()
+	omens, mults := float64(s.omens.Total()), float64(s.multipliers.Total())
+
+	var outcomes []Outcome
+	index := make(map[string]int)
+	add := func(label string, p float64) {
+		if i, ok := index[label]; ok {
+			outcomes[i].P += p
+			return
+		}
+
+		index[label] = len(outcomes)
+		outcomes = append(outcomes, Outcome{Label: label, P: p})
+	}
+
+	for _, o := range s.omens.Entries() {
+		p := float64(o.Weight) / omens
+		if o.Label == "" {
+			add(neutralOmen, p)
+			continue
+		}
+
+		for _, m := range s.multipliers.Entries() {
+			add(m.Label+o.Label, p*float64(m.Weight)/mults)
+		}
+	}
+
+	return outcomes
+}
+
+func (divineOracle) Outcome(_, answer string) string {
+	_, result, _ := cutLast(answer, divineResult)
+	return result
+}
+
+// Record counts the omen and multiplier of a divination sent, as they were
+// drawn.
+func (divineOracle) Record(ctx *UpdateContext) {
+	d := ctx.Divination
+	if d == nil {
+		return
+	}
+
+	if d.Omen == "" {
+		divineOmensTotal.With(neutralOmen).Inc()
+		return
+	}
+
+	divineOmensTotal.With(d.Omen).Inc()
+	divineMultipliersTotal.With(metricLabel(d.Multiplier)).Inc()
+}
+
+// piaOracle sends a cat or, rarely, a dog to slap the query.
+type piaOracle struct{}
+
+func (piaOracle) ID() string { return "pia" }
+
+func (piaOracle) Title(string) string { return "Pia" }
+
+func (piaOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "Pia 一下"
+	}
+
+	return "Slap it"
+}
+
+func (piaOracle) Consult(ctx *UpdateContext) string {
+	return pia(ctx)
+}
+
+func (piaOracle) Expected(string) []Outcome {
+	return []Outcome{{Label: "dog", P: 1.0 / 8}, {Label: "cat", P: 7.0 / 8}}
+}
+
+func (piaOracle) Outcome(_, answer string) string {
+	switch {
+	case strings.HasPrefix(answer, piaDog):
+		return "dog"
+	case strings.HasPrefix(answer, piaCat):
+		return "cat"
+	default:
+		return ""
+	}
+}
+
+// cutLast slices s around the last instance of sep.
+//
+// Parameters:
+//   - s: The string to cut.
+//   - sep: The separator.
+//
+// Returns:
+//   - The text before and after the separator, and whether it was found.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubOracle is a minimal oracle for registry tests.
+type stubOracle struct {
+	id     string
+	accept bool
+}
+
+func (o stubOracle) ID() string                        { return o.id }
+func (o stubOracle) Title(string) string               { return o.id }
+func (o stubOracle) Description(string) string         { return o.id }
+func (o stubOracle) Consult(ctx *UpdateContext) string { return o.id + ":" + *ctx.Query }
+func (o stubOracle) Accepts(string) bool               { return o.accept }
+
+func TestOracleRegistry(t *testing.T) {
+	a, b, c := stubOracle{id: "a"}, stubOracle{id: "b"}, stubOracle{id: "c"}
+	r := NewOracleRegistry(a, b, c)
+
+	assert.Equal(t, []Oracle{a, b, c}, r.All())
+
+	o, ok := r.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, b, o)
+
+	_, ok = r.Get("d")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() { r.Register(stubOracle{id: "a"}) })
+}
+
+func TestOracleRegistrySelect(t *testing.T) {
+	a, b, c := stubOracle{id: "a"}, stubOracle{id: "b"}, stubOracle{id: "c"}
+	r := NewOracleRegistry(a, b, c)
+
+	selected, err := r.Select(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Oracle{a, b, c}, selected)
+
+	selected, err = r.Select([]string{"c", "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Oracle{c, a}, selected)
+
+	_, err = r.Select([]string{"a", "d"})
+	assert.Error(t, err)
+
+	_, err = r.Select([]string{"a", "a"})
+	assert.Error(t, err)
+}
+
+func TestAccepts(t *testing.T) {
+	assert.True(t, accepts(divineOracle{}, "anything"))
+	assert.True(t, accepts(stubOracle{id: "a", accept: true}, "anything"))
+	assert.False(t, accepts(stubOracle{id: "a"}, "anything"))
+}
+
+func TestIsKeyword(t *testing.T) {
+	assert.True(t, isKeyword(almanacOracle{}, "黄历"))
+	assert.True(t, isKeyword(almanacOracle{}, "  Almanac "))
+	assert.False(t, isKeyword(almanacOracle{}, "今天黄历"))
+	assert.False(t, isKeyword(divineOracle{}, "黄历"))
+}
+
+func TestBuildInlineQueryResultsKeyword(t *testing.T) {
+	user := &models.User{ID: 42, LanguageCode: "zh"}
+
+	results, _ := buildInlineQueryResults(currentSettings(), user, "黄历", time.Now())
+	require.Len(t, results, 1)
+	assert.Equal(t, "almanac", results[0].(*models.InlineQueryResultArticle).ID)
+
+	// The almanac answers any query, but only keywords show it alone.
+	var ids []string
+	results, _ = buildInlineQueryResults(currentSettings(), user, "明天的黄历", time.Now())
+	for _, r := range results {
+		ids = append(ids, r.(*models.InlineQueryResultArticle).ID)
+	}
+	assert.Contains(t, ids, "divine")
+	assert.Contains(t, ids, "almanac")
+}
+
+func TestInlineCaching(t *testing.T) {
+	// 23:00 on Saturday 2024-02-10 in Shanghai.
+	now := time.Date(2024, time.February, 10, 15, 0, 0, 0, time.UTC)
+	article := func(id string) models.InlineQueryResult {
+		return &models.InlineQueryResultArticle{ID: id}
+	}
+	almanac := []models.InlineQueryResult{article("almanac")}
+
+	tests := []struct {
+		name       string
+		conf       Config
+		results    []models.InlineQueryResult
+		isPersonal bool
+		cacheTime  int
+	}{
+		{name: "almanac until midnight", results: almanac, cacheTime: 3600},
+		{
+			name:      "configured window",
+			conf:      Config{Windows: map[string]Window{"almanac": {unit: windowWeek}}},
+			results:   almanac,
+			cacheTime: 25 * 3600,
+		},
+		{
+			name:      "default title",
+			conf:      Config{Titles: map[string]map[string]string{"almanac": {defaultLocale: "今日黄历"}}},
+			results:   almanac,
+			cacheTime: 3600,
+		},
+		{
+			name:       "title per locale",
+			conf:       Config{Titles: map[string]map[string]string{"almanac": {"en": "Almanac"}}},
+			results:    almanac,
+			isPersonal: true,
+		},
+		{name: "personal oracle", results: []models.InlineQueryResult{article("divine"), article("almanac")}, isPersonal: true},
+		{name: "localized oracle", results: []models.InlineQueryResult{article("xiaoliuren")}, isPersonal: true},
+		{name: "no results", isPersonal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Timezone = "Asia/Shanghai"
+			s, err := newSettings(&tt.conf)
+			require.NoError(t, err)
+
+			isPersonal, cacheTime := inlineCaching(s, tt.results, now)
+			assert.Equal(t, tt.isPersonal, isPersonal)
+			assert.Equal(t, tt.cacheTime, cacheTime)
+		})
+	}
+}
+
+func TestRegisteredOracles(t *testing.T) {
+	command := regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+	for _, o := range oracles.All() {
+		t.Run(o.ID(), func(t *testing.T) {
+			assert.Regexp(t, command, o.ID(), "ID must be a valid bot command")
+
+			for _, locale := range []string{"zh", "en", ""} {
+				assert.NotEmpty(t, o.Title(locale))
+				assert.NotEmpty(t, o.Description(locale))
+			}
+
+			query := "question"
+			if accepts(o, query) {
+				rctx := buildUpdateContextAt(seedSchemeV1{}, Seed{UserID: 42, Query: query}, "zh")
+				rctx.Time = time.Now()
+				rctx.Settings = currentSettings()
+				assert.NotEmpty(t, o.Consult(rctx))
+			}
+		})
+	}
+}
+
+func TestConsultOraclesSkipsRejecting(t *testing.T) {
+	s := testSettings(t,
+		stubOracle{id: "a", accept: true},
+		stubOracle{id: "b"},
+		stubOracle{id: "c", accept: true},
+	)
+
+	answers := consultOracles(s, &models.User{ID: 1}, "q", time.Now())
+	assert.Len(t, answers, 2)
+	assert.Equal(t, "a:q", answers[0].Text)
+	assert.Equal(t, "c:q", answers[1].Text)
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		arg  string
+		ok   bool
+	}{
+		{text: "/divine 明天会下雨吗", name: "divine", arg: "明天会下雨吗", ok: true},
+		{text: "/Divine@PgbBot  question ", name: "divine", arg: "question", ok: true},
+		{text: "/dice@pgbbot d20", name: "dice", arg: "d20", ok: true},
+		{text: "/dice@OtherBot d20"},
+		{text: "/divine@ question"},
+		{text: "/pia", name: "pia", ok: true},
+		{text: "divine question"},
+		{text: "/ question"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			name, arg, ok := parseCommand(tt.text, "PgbBot")
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.arg, arg)
+		})
+	}
+}
+
+func TestBuildCommandReplyMatchesInline(t *testing.T) {
+	user := &models.User{ID: 42, LanguageCode: "en"}
+	sent := oracleResultsTotal.With("divine")
+	before := sent.Value()
+
+	results, answers := buildInlineQueryResults(currentSettings(), user, "question", time.Now())
+	assert.Len(t, answers, len(results))
+
+	for _, r := range results {
+		article := r.(*models.InlineQueryResultArticle)
+		reply, ok := buildCommandReply(user, article.ID, "question")
+		assert.True(t, ok)
+		assert.Equal(t, article.InputMessageContent.(*models.InputTextMessageContent).MessageText, reply.Text)
+	}
+
+	// Nothing is counted until the answers are sent.
+	assert.Equal(t, before, sent.Value())
+
+	_, ok := buildCommandReply(user, "start", "")
+	assert.False(t, ok)
+}
+
+func TestPiaIndependentOfOrder(t *testing.T) {
+	now := time.Date(2024, time.May, 15, 17, 10, 0, 0, time.UTC)
+	consult := func(enabled ...Oracle) map[string]string {
+		texts := map[string]string{}
+		for _, a := range consultOraclesAt(testSettings(t, enabled...), 42, "问题", "zh", now) {
+			texts[a.Oracle.ID()] = a.Text
+		}
+
+		return texts
+	}
+
+	want := consult(divineOracle{}, piaOracle{})
+
+	assert.Equal(t, want, consult(piaOracle{}, divineOracle{}))
+	assert.Equal(t, want["pia"], consult(piaOracle{})["pia"])
+	assert.Equal(t, want["pia"], consult(tarotOracle{}, piaOracle{})["pia"])
+}
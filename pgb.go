@@ -17,40 +17,24 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/binary"
-	"log"
+	"log/slog"
+	"math"
 	"math/rand"
-	"net"
-	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	"github.com/sethvargo/go-envconfig"
 )
 
-// Config represents the configuration settings for the application. It includes
-// the following fields:
-//
-//   - Host: The hostname or IP address where the application will run. It is
-//     set via the "HOST" environment variable and defaults to "0.0.0.0".
-//   - Port: The port number on which the application will listen. It is set via
-//     the "PORT" environment variable and defaults to "8080".
-//   - Token: A required authentication token for the application. It is set via
-//     the "TOKEN" environment variable.
-type Config struct {
-	Debug   bool          `env:"DEBUG, default=false"`
-	Host    string        `env:"HOST, default=0.0.0.0"`
-	Port    string        `env:"PORT, default=8080"`
-	Timeout time.Duration `env:"TIMEOUT, default=5s"`
-	Token   string        `env:"TOKEN, required"`
-}
+// version is the release version of pgb. It is injected at build time by the
+// Makefile through -ldflags "-X main.version=...".
+var version string
 
 // UpdateContext holds the context for an update operation. It includes a random
 // number generator, a query string, and a locale.
@@ -59,10 +43,19 @@ type Config struct {
 // - Rand: A pointer to a rand.Rand instance used for generating random numbers.
 // - Query: A pointer to a string representing the query to be executed.
 // - Locale: A string representing the locale of the user.
+// - Time: The time of the query in the configured timezone.
+// - Settings: The settings the query is answered with. Oracles read their
+// tables and data from it rather than from the live settings, so that an
+// answer never mixes the settings before and after a reload.
+// - Divination: The divination drawn at the start of the stream of divine, or
+// nil until it is drawn.
 type UpdateContext struct {
-	Rand   *rand.Rand
-	Query  *string
-	Locale *string
+	Rand       *rand.Rand
+	Query      *string
+	Locale     *string
+	Time       time.Time
+	Settings   *settings
+	Divination *divination
 }
 
 // builder is a custom type that embeds strings.Builder to provide additional
@@ -105,6 +98,12 @@ func newRand(seeds []uint64) *rand.Rand {
 	return rand.New(rand.NewSource(int64(s)))
 }
 
+// The pia prefixes of the dog and the cat.
+const (
+	piaDog = "Pia!▼(ｏ ‵-′)ノ★ "
+	piaCat = "Pia!<(=ｏ ‵-′)ノ☆ "
+)
+
 // getPiaPrefix returns the pia prefix based on a random value. There is a 1 in 8
 // chance to summon a dog and a 7 in 8 chance to summon a cat.
 //
@@ -116,9 +115,9 @@ func newRand(seeds []uint64) *rand.Rand {
 func getPiaPrefix(r uint64) string {
 	switch r % 8 {
 	case 0:
-		return "Pia!▼(ｏ ‵-′)ノ★ "
+		return piaDog
 	default:
-		return "Pia!<(=ｏ ‵-′)ノ☆ "
+		return piaCat
 	}
 }
 
@@ -143,32 +142,27 @@ func pia(ctx *UpdateContext) string {
 	return b.String()
 }
 
-// getOmen determines the omen ("吉", "凶", or empty string for "尚可") based on
-// a random value. The probabilities are distributed as follows:
+// divineResult separates the query from the result in a divination, and
+// neutralOmen is the result shown for the empty omen.
+const (
+	divineResult = "\n结果: "
+	neutralOmen  = "尚可"
+)
+
+// defaultOmens is the built-in omen table. The empty label stands for the
+// neutral omen "尚可". Out of 16:
 //   - 凶 (bad): 0-6 (7/16 chance = 43.75%)
 //   - "" (neutral/尚可): 7-8 (2/16 chance = 12.5%)
 //   - 吉 (good): 9-15 (7/16 chance = 43.75%)
-//
-// Parameters:
-//   - r: A random uint64 value used to determine the omen.
-//
-// Returns:
-//   - A string containing the omen ("吉", "凶", or empty string).
-func getOmen(r uint64) string {
-	o := r % 16
-	switch {
-	case 9 <= o:
-		return "吉"
-	case o < 7:
-		return "凶"
-	default:
-		return ""
-	}
-}
-
-// getMultiplier determines the multiplier string based on a random value.
-// The multiplier represents the intensity of the divination result following
-// a hierarchy from extremely small to extremely large:
+var defaultOmens = mustWeightedTable([]Weighted[string]{
+	{Label: "凶", Weight: 7},
+	{Label: "", Weight: 2},
+	{Label: "吉", Weight: 7},
+})
+
+// defaultMultipliers is the built-in multiplier table. The multiplier
+// represents the intensity of the divination result following a hierarchy
+// from extremely small to extremely large. Out of 1024:
 //   - 极小 (extremely small): 0-0 (1/1024 chance)
 //   - 超小 (super small): 1-10 (10/1024 chance)
 //   - 特小 (ultra small): 11-55 (45/1024 chance)
@@ -180,38 +174,80 @@ func getOmen(r uint64) string {
 //   - 特大 (ultra large): 968-1012 (45/1024 chance)
 //   - 超大 (super large): 1013-1022 (10/1024 chance)
 //   - 极大 (extremely large): 1023+ (1/1024 chance)
+var defaultMultipliers = mustWeightedTable([]Weighted[string]{
+	{Label: "极小", Weight: 1},
+	{Label: "超小", Weight: 10},
+	{Label: "特小", Weight: 45},
+	{Label: "甚小", Weight: 120},
+	{Label: "小", Weight: 210},
+	{Label: "", Weight: 252},
+	{Label: "大", Weight: 210},
+	{Label: "甚大", Weight: 120},
+	{Label: "特大", Weight: 45},
+	{Label: "超大", Weight: 10},
+	{Label: "极大", Weight: 1},
+})
+
+// getOmen determines the omen ("吉", "凶", or empty string for "尚可") based on
+// a random value, using the omen table of the settings. See defaultOmens for
+// the built-in probabilities.
+//
+// Parameters:
+//   - s: The settings providing the omen table.
+//   - r: A random uint64 value used to determine the omen.
+//
+// Returns:
+//   - A string containing the omen ("吉", "凶", or empty string).
+func getOmen(s *settings, r uint64) string {
+	return s.omens.Sample(r)
+}
+
+// getMultiplier determines the multiplier string based on a random value,
+// using the multiplier table of the settings. See defaultMultipliers for the
+// built-in probabilities.
 //
 // Parameters:
+//   - s: The settings providing the multiplier table.
 //   - r: A random uint64 value used to determine the multiplier.
 //
 // Returns:
 //   - A string containing the multiplier ("极小", "超小", etc., or empty string).
-func getMultiplier(r uint64) string {
-	m := r % 1024
-	switch {
-	case m < 1:
-		return "极小"
-	case 1 <= m && m < 11:
-		return "超小"
-	case 11 <= m && m < 56:
-		return "特小"
-	case 56 <= m && m < 176:
-		return "甚小"
-	case 176 <= m && m < 386:
-		return "小"
-	case 386 <= m && m < 638:
-		return ""
-	case 638 <= m && m < 848:
-		return "大"
-	case 848 <= m && m < 968:
-		return "甚大"
-	case 968 <= m && m < 1013:
-		return "特大"
-	case 1013 <= m && m < 1023:
-		return "超大"
-	default: // m >= 1023
-		return "极大"
+func getMultiplier(s *settings, r uint64) string {
+	return s.multipliers.Sample(r)
+}
+
+// divination is the outcome of a divination.
+//
+// Fields:
+// - Omen: The omen ("吉", "凶", or empty string for "尚可").
+// - Multiplier: The multiplier of a non-neutral omen.
+type divination struct {
+	Omen       string
+	Multiplier string
+}
+
+// drawDivination returns the divination of an UpdateContext, drawing it from
+// the random number generator the first time. The stream of divine always
+// starts with the divination, whichever oracles are enabled and in whatever
+// order, so that pia, which continues the stream, always draws the same
+// numbers.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext on the stream of divine.
+//
+// Returns:
+//   - The divination.
+func drawDivination(ctx *UpdateContext) *divination {
+	if ctx.Divination == nil {
+		d := &divination{Omen: getOmen(ctx.Settings, ctx.Rand.Uint64())}
+		if d.Omen != "" {
+			d.Multiplier = getMultiplier(ctx.Settings, ctx.Rand.Uint64())
+		}
+
+		ctx.Divination = d
 	}
+
+	return ctx.Divination
 }
 
 // divine generates a divination result based on the provided UpdateContext. It
@@ -229,66 +265,26 @@ func getMultiplier(r uint64) string {
 func divine(ctx *UpdateContext) string {
 	var b builder
 
-	b.WriteStrings("所求事项: ", *ctx.Query, "\n结果: ")
+	b.WriteStrings("所求事项: ", *ctx.Query, divineResult)
 
-	omen := getOmen(ctx.Rand.Uint64())
+	d := drawDivination(ctx)
 
-	if omen == "" {
-		b.WriteString("尚可")
+	if d.Omen == "" {
+		b.WriteString(neutralOmen)
 	} else {
-		mult := getMultiplier(ctx.Rand.Uint64())
-		b.WriteStrings(mult, omen)
+		b.WriteStrings(d.Multiplier, d.Omen)
 	}
 
 	return b.String()
 }
 
 func main() {
-	var conf Config
-
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	if err := envconfig.Process(ctx, &conf); err != nil {
-		log.Fatal(err)
-	}
-
-	opts := []bot.Option{
-		bot.WithDefaultHandler(handler),
-		bot.WithCheckInitTimeout(conf.Timeout),
-	}
-
-	if conf.Debug {
-		opts = append(opts, bot.WithDebug())
-	}
-
-	if b, err := bot.New(conf.Token, opts...); nil != err {
-		panic(err)
-	} else {
-		go b.StartWebhook(ctx)
-
-		http.ListenAndServe(
-			net.JoinHostPort(conf.Host, conf.Port),
-			b.WebhookHandler(),
-		)
-	}
-}
-
-// getLocaleTitles returns the localized titles for the divine and pia results
-// based on the locale string.
-//
-// Parameters:
-//   - locale: the user's language code (e.g., "zh", "en").
-//
-// Returns:
-//   - divineTitle: the localized title for the divination result.
-//   - piaTitle: the localized title for the pia result.
-func getLocaleTitles(locale string) (string, string) {
-	switch locale {
-	case "zh":
-		return "求签", "Pia"
-	default:
-		return "Divination", "Pia"
+	if err := runCommand(ctx, os.Args[1:]); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
@@ -322,69 +318,281 @@ func getUserLocale(user *models.User) string {
 	return "zh"
 }
 
-// buildUpdateContext creates an UpdateContext for a given user ID, query, and
-// locale. It generates a deterministic random number generator seeded by the
-// user ID, time, and query.
+// buildUpdateContextAt creates an UpdateContext for a query whose random
+// number generator is derived from the given seed inputs with the given
+// scheme.
 //
 // Parameters:
-//   - userID: the user's ID as uint64.
-//   - queryText: the query string.
+//   - scheme: the seed scheme.
+//   - seed: the inputs of the seed, including the query shown to the user.
 //   - locale: the user's locale string.
 //
 // Returns:
 //   - pointer to an UpdateContext struct.
-func buildUpdateContext(userID uint64, queryText, locale string) *UpdateContext {
-	h := sha256.New()
-	_ = binary.Write(h, binary.LittleEndian, userID)
-	_ = binary.Write(h, binary.LittleEndian, time.Now().Truncate(30*time.Minute).Unix())
-	_ = binary.Write(h, binary.LittleEndian, []byte(queryText))
-	r := bytes.NewReader(h.Sum(nil))
-	seeds := make([]uint64, 4)
-	_ = binary.Read(r, binary.BigEndian, &seeds)
+func buildUpdateContextAt(scheme SeedScheme, seed Seed, locale string) *UpdateContext {
+	queryText := seed.Query
+
 	return &UpdateContext{
-		Rand:   newRand(seeds),
+		Rand:   scheme.NewRand(seed),
 		Query:  &queryText,
 		Locale: &locale,
 	}
 }
 
+// answer is the reply of one oracle to a query.
+//
+// Fields:
+// - Oracle: The oracle answering.
+// - Text: The message text of the answer.
+// - Context: The UpdateContext the oracle was consulted with, holding what
+// it drew, such as the divination.
+type answer struct {
+	Oracle  Oracle
+	Text    string
+	Context *UpdateContext
+}
+
+// consultOracles consults every enabled oracle that accepts the query, in the
+// configured order. Inline results and bot commands both go through this
+// function so that they give the same answers.
+//
+// Parameters:
+//   - s: The settings providing the enabled oracles.
+//   - user: pointer to a models.User struct (may be nil).
+//   - queryText: the query string.
+//   - now: the time of the query.
+//
+// Returns:
+//   - The answers of the oracles that accepted the query.
+func consultOracles(s *settings, user *models.User, queryText string, now time.Time) []answer {
+	return consultOraclesAt(s, getUserID(user), queryText, getUserLocale(user), now)
+}
+
+// consultOraclesAt is like consultOracles for a query asked at the given
+// time. Each oracle draws from an UpdateContext of its own, derived from the
+// start of its window, so that its answer holds for the whole window whatever
+// the windows of the other oracles. Pia shares the context of divine when
+// both have the same window, and draws after the divination as it always has,
+// even if divine is disabled or comes later.
+//
+// Parameters:
+//   - s: The settings providing the enabled oracles and their windows.
+//   - userID: the user's ID as uint64.
+//   - queryText: the query string.
+//   - locale: the user's locale string.
+//   - now: the time of the query.
+//
+// Returns:
+//   - The answers of the oracles that accepted the query.
+func consultOraclesAt(s *settings, userID uint64, queryText, locale string, now time.Time) []answer {
+	type streamKey struct {
+		stream string
+		window Window
+	}
+
+	contexts := make(map[streamKey]*UpdateContext)
+
+	answers := make([]answer, 0, len(s.oracles))
+	for _, o := range s.oracles {
+		if !accepts(o, queryText) {
+			continue
+		}
+
+		key := streamKey{stream: streamOf(o), window: s.windowOf(o)}
+
+		rctx, ok := contexts[key]
+		if !ok {
+			rctx = buildUpdateContextAt(s.seedScheme, Seed{
+				Secret:    s.seedSecret,
+				UserID:    userID,
+				Window:    key.window.Start(now, s.location),
+				Query:     queryText,
+				Normalize: s.normalizer.Normalize,
+			}, locale)
+			rctx.Time = now.In(s.location)
+			rctx.Settings = s
+			contexts[key] = rctx
+
+			if key.stream == (divineOracle{}).ID() {
+				drawDivination(rctx)
+			}
+		}
+
+		answers = append(answers, answer{Oracle: o, Text: o.Consult(rctx), Context: rctx})
+	}
+
+	return answers
+}
+
 // buildInlineQueryResults generates the inline query results for a given user
-// and query text. It determines the locale and user ID, builds the
-// UpdateContext, and returns the results.
+// and query text, one article per enabled oracle that accepts the query. A
+// query that is a keyword of some oracles only shows their articles.
 //
 // Parameters:
+//   - s: The settings the query is answered with.
 //   - user: pointer to a models.User struct (may be nil).
 //   - queryText: the query string.
+//   - now: the time of the query.
 //
 // Returns:
-//   - slice of models.InlineQueryResult containing the divine and pia articles.
-func buildInlineQueryResults(user *models.User, queryText string) []models.InlineQueryResult {
+//   - slice of models.InlineQueryResult containing one article per oracle.
+//   - The answers shown in the articles, to be recorded once they are sent.
+func buildInlineQueryResults(s *settings, user *models.User, queryText string, now time.Time) ([]models.InlineQueryResult, []answer) {
 	locale := getUserLocale(user)
-	userID := getUserID(user)
 
-	rctx := buildUpdateContext(userID, queryText, locale)
-	divineTitle, piaTitle := getLocaleTitles(locale)
+	answers := keywordAnswers(consultOracles(s, user, queryText, now), queryText)
 
-	results := []models.InlineQueryResult{
-		&models.InlineQueryResultArticle{
-			ID:    "divine",
-			Title: divineTitle,
-			InputMessageContent: &models.InputTextMessageContent{
-				MessageText: divine(rctx),
-			},
-		},
-		&models.InlineQueryResultArticle{
-			ID:    "pia",
-			Title: piaTitle,
+	results := make([]models.InlineQueryResult, 0, len(answers))
+	for _, a := range answers {
+		results = append(results, &models.InlineQueryResultArticle{
+			ID:          a.Oracle.ID(),
+			Title:       s.title(a.Oracle, locale),
+			Description: a.Oracle.Description(locale),
 			InputMessageContent: &models.InputTextMessageContent{
-				MessageText: pia(rctx),
+				MessageText: a.Text,
 			},
-		},
+		})
+	}
+
+	return results, answers
+}
+
+// keywordAnswers narrows the answers to a query down to those of the oracles
+// the query is a keyword of.
+//
+// Parameters:
+//   - answers: The answers of the oracles that accepted the query.
+//   - queryText: the query string.
+//
+// Returns:
+//   - The answers of the oracles the query is a keyword of, or all answers
+//     if it is a keyword of none.
+func keywordAnswers(answers []answer, queryText string) []answer {
+	matched := slices.DeleteFunc(slices.Clone(answers), func(a answer) bool {
+		return !isKeyword(a.Oracle, queryText)
+	})
+	if len(matched) == 0 {
+		return answers
+	}
+
+	return matched
+}
+
+// inlineCaching decides how Telegram may cache inline query results. Results
+// that all come from Impersonal oracles and read the same in every locale are
+// the same for everyone, so they are shared between users until the earliest
+// of their windows ends. Any other results are cached only for the user who
+// asked, for Telegram's default time.
+//
+// Parameters:
+//   - s: The settings providing the windows and titles of the oracles.
+//   - results: The inline query results, whose IDs are oracle IDs.
+//   - now: The time of the query.
+//
+// Returns:
+//   - isPersonal: Whether the results may only be cached for the user.
+//   - cacheTime: The seconds the results may be cached, or 0 for Telegram's
+//     default.
+func inlineCaching(s *settings, results []models.InlineQueryResult, now time.Time) (isPersonal bool, cacheTime int) {
+	if len(results) == 0 {
+		return true, 0
+	}
+
+	var end time.Time
+	for _, r := range results {
+		article, ok := r.(*models.InlineQueryResultArticle)
+		if !ok {
+			return true, 0
+		}
+
+		o, _ := oracles.Get(article.ID)
+		if _, ok := o.(Impersonal); !ok || s.localized(o) {
+			return true, 0
+		}
+
+		if e := s.windowOf(o).End(now, s.location); end.IsZero() || e.Before(end) {
+			end = e
+		}
+	}
+
+	return false, int(math.Ceil(end.Sub(now).Seconds()))
+}
+
+// parseCommand splits a bot command message such as "/divine@PgbBot question"
+// into the command name and its argument. A command addressed to another bot
+// with "@" is not a command of this bot.
+//
+// Parameters:
+//   - text: The message text.
+//   - username: The username of the bot, without the leading "@".
+//
+// Returns:
+//   - name: The lowercased command name without the leading slash and bot
+//     username.
+//   - arg: The text following the command, with surrounding whitespace
+//     removed.
+//   - ok: Whether the text is a command of this bot at all.
+func parseCommand(text, username string) (name, arg string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	cmd, arg, _ := strings.Cut(text[1:], " ")
+	cmd, target, addressed := strings.Cut(cmd, "@")
+	if cmd == "" || addressed && !strings.EqualFold(target, username) {
+		return "", "", false
+	}
+
+	return strings.ToLower(cmd), strings.TrimSpace(arg), true
+}
+
+// buildCommandReply answers a bot command naming an enabled oracle with the
+// same text the oracle's inline result would show for the query.
+//
+// Parameters:
+//   - user: pointer to a models.User struct (may be nil).
+//   - name: the command name.
+//   - queryText: the query string.
+//
+// Returns:
+//   - The answer, to be recorded once it is sent, and whether an enabled
+//     oracle accepted the command.
+func buildCommandReply(user *models.User, name, queryText string) (answer, bool) {
+	s := currentSettings()
+
+	if !slices.ContainsFunc(s.oracles, func(o Oracle) bool { return o.ID() == name }) {
+		return answer{}, false
+	}
+
+	for _, a := range consultOracles(s, user, queryText, time.Now()) {
+		if a.Oracle.ID() == name {
+			return a, true
+		}
+	}
+
+	return answer{}, false
+}
+
+// handler dispatches an incoming update: inline queries are answered with the
+// results of all enabled oracles, and messages starting with the ID of an
+// enabled oracle as a command, such as "/divine question", are replied to
+// with that oracle's answer. Other updates are ignored.
+//
+// Parameters:
+//   - ctx: The context for the request, used for cancellation and deadlines.
+//   - b: The bot instance handling the request.
+//   - update: The update to be processed.
+//   - username: The username of the bot.
+func handler(ctx context.Context, b *bot.Bot, update *models.Update, username string) {
+	switch {
+	case update.InlineQuery != nil:
+		answerInlineQuery(ctx, b, update.InlineQuery)
+	case update.Message != nil:
+		answerCommand(ctx, b, update.Message, username)
 	}
-	return results
 }
 
-// handler processes an incoming inline query from a bot and generates a
+// answerInlineQuery processes an incoming inline query and generates a
 // response.  It uses the query details and current time to create a unique
 // context for the query, then generates a set of inline query results based on
 // this context and sends them back.
@@ -392,30 +600,89 @@ func buildInlineQueryResults(user *models.User, queryText string) []models.Inlin
 // Parameters:
 //   - ctx: The context for the request, used for cancellation and deadlines.
 //   - b: The bot instance handling the request.
-//   - update: The update containing the inline query to be processed.
+//   - query: The inline query to be processed.
 //
 // The function performs the following steps:
-//  1. Checks if the update contains an inline query. If not, it returns
-//     immediately.
-//  2. Creates a SHA-256 hash based on the user's ID, current time truncated to
-//     30 minutes, and the query text.
-//  3. Uses the hash to seed a random number generator.
-//  4. Creates an UpdateContext with the random number generator and query text.
-//  5. Generates a set of inline query results using the UpdateContext.
-//  6. Sends the generated results back to the bot as a response to the inline
-//     query.
-func handler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if update.InlineQuery == nil {
-		return
+//  1. Derives a seed from the user's ID, the start of each oracle's window
+//     containing the current time, and the query text, using the configured
+//     seed scheme and secret.
+//  2. Uses the seed to create a random number generator.
+//  3. Creates an UpdateContext with the random number generator and query text.
+//  4. Generates a set of inline query results using the UpdateContext.
+//  5. Sends the generated results back to the bot as a response to the inline
+//     query, to be cached for everyone only if they are the same for everyone.
+//
+// The results and their caching are decided with the same settings and time,
+// so that a reload or a window ending in between cannot share results beyond
+// the window they were built for.
+func answerInlineQuery(ctx context.Context, b *bot.Bot, query *models.InlineQuery) {
+	user := query.From
+	queryText := query.Query
+	s, now := currentSettings(), time.Now()
+	inlineQueriesTotal.With(getUserLocale(user)).Inc()
+	results, answers := buildInlineQueryResults(s, user, queryText, now)
+	isPersonal, cacheTime := inlineCaching(s, results, now)
+	logger := loggerFrom(ctx)
+	for _, r := range results {
+		if a, ok := r.(*models.InlineQueryResultArticle); ok {
+			logger.Debug("inline result", slog.String("oracle", a.ID))
+		}
 	}
-	user := update.InlineQuery.From
-	queryText := update.InlineQuery.Query
-	results := buildInlineQueryResults(user, queryText)
-	b.AnswerInlineQuery(
+	start := time.Now()
+	_, err := b.AnswerInlineQuery(
 		ctx,
 		&bot.AnswerInlineQueryParams{
-			InlineQueryID: update.InlineQuery.ID,
+			InlineQueryID: query.ID,
 			Results:       results,
+			IsPersonal:    isPersonal,
+			CacheTime:     cacheTime,
 		},
 	)
+	observeTelegramRequest("answerInlineQuery", start, err)
+	if err != nil {
+		logger.Error("answer inline query", slog.Any("error", err))
+		return
+	}
+
+	for _, a := range answers {
+		recordAnswer(a)
+	}
+}
+
+// answerCommand replies to a message invoking an oracle as a bot command.
+// Messages that are not commands of an enabled oracle, or that address the
+// command to another bot, are ignored.
+//
+// Parameters:
+//   - ctx: The context for the request, used for cancellation and deadlines.
+//   - b: The bot instance handling the request.
+//   - msg: The message to be processed.
+//   - username: The username of the bot.
+func answerCommand(ctx context.Context, b *bot.Bot, msg *models.Message, username string) {
+	name, queryText, ok := parseCommand(msg.Text, username)
+	if !ok {
+		return
+	}
+
+	reply, ok := buildCommandReply(msg.From, name, queryText)
+	if !ok {
+		return
+	}
+
+	logger := loggerFrom(ctx).With(slog.String("oracle", name))
+	logger.Debug("command reply")
+
+	start := time.Now()
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          msg.Chat.ID,
+		Text:            reply.Text,
+		ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+	})
+	observeTelegramRequest("sendMessage", start, err)
+	if err != nil {
+		logger.Error("reply to command", slog.Any("error", err))
+		return
+	}
+
+	recordAnswer(reply)
 }
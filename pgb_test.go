@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-telegram/bot/models"
 	"github.com/stretchr/testify/assert"
@@ -100,8 +101,9 @@ func TestDivineOutput(t *testing.T) {
 	r := newRand(seed)
 	query := "question"
 	ctx := &UpdateContext{
-		Rand:  r,
-		Query: &query,
+		Rand:     r,
+		Query:    &query,
+		Settings: currentSettings(),
 	}
 	result := divine(ctx)
 	assert.Contains(t, result, "所求事项: question", "divine should contain query")
@@ -117,8 +119,19 @@ func TestBuildInlineQueryResults(t *testing.T) {
 		Username:     "",
 		LanguageCode: "zh",
 	}
-	results := buildInlineQueryResults(user, "问题")
-	assert.Equal(t, 2, len(results), "Should return 2 results")
+	results, _ := buildInlineQueryResults(currentSettings(), user, "问题", time.Now())
+
+	var expected, ids []string
+	for _, o := range oracles.All() {
+		if accepts(o, "问题") {
+			expected = append(expected, o.ID())
+		}
+	}
+	for _, r := range results {
+		ids = append(ids, r.(*models.InlineQueryResultArticle).ID)
+	}
+	assert.Equal(t, expected, ids, "Should return one result per accepting oracle")
+
 	if article, ok := results[0].(*models.InlineQueryResultArticle); ok {
 		assert.True(t, article.Title == "求签" || article.Title == "Divination", "First result title should be '求签' or 'Divination'")
 	} else {
@@ -126,24 +139,22 @@ func TestBuildInlineQueryResults(t *testing.T) {
 	}
 }
 
-func TestGetLocaleTitles(t *testing.T) {
-	d, p := getLocaleTitles("zh")
-	assert.Equal(t, "求签", d)
-	assert.Equal(t, "Pia", p)
-	d, p = getLocaleTitles("en")
-	assert.Equal(t, "Divination", d)
-	assert.Equal(t, "Pia", p)
-	d, p = getLocaleTitles("")
-	assert.Equal(t, "Divination", d)
-	assert.Equal(t, "Pia", p)
+func TestOracleTitles(t *testing.T) {
+	var d, p Oracle = divineOracle{}, piaOracle{}
+	assert.Equal(t, "求签", d.Title("zh"))
+	assert.Equal(t, "Pia", p.Title("zh"))
+	assert.Equal(t, "Divination", d.Title("en"))
+	assert.Equal(t, "Pia", p.Title("en"))
+	assert.Equal(t, "Divination", d.Title(""))
+	assert.Equal(t, "Pia", p.Title(""))
 }
 
-func TestBuildUpdateContext(t *testing.T) {
-	userID := uint64(12345)
+func TestBuildUpdateContextAt(t *testing.T) {
+	seed := Seed{UserID: 12345, Window: time.Now().Truncate(30 * time.Minute), Query: "test-query"}
 	query := "test-query"
 	locale := "zh"
-	rctx1 := buildUpdateContext(userID, query, locale)
-	rctx2 := buildUpdateContext(userID, query, locale)
+	rctx1 := buildUpdateContextAt(seedSchemeV1{}, seed, locale)
+	rctx2 := buildUpdateContextAt(seedSchemeV1{}, seed, locale)
 	assert.NotNil(t, rctx1)
 	assert.NotNil(t, rctx2)
 	assert.Equal(t, *rctx1.Query, query)
@@ -249,7 +260,7 @@ func TestGetOmen(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := getOmen(tt.randValue)
+			result := getOmen(currentSettings(), tt.randValue)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -330,7 +341,7 @@ func TestGetMultiplier(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := getMultiplier(tt.randValue)
+			result := getMultiplier(currentSettings(), tt.randValue)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
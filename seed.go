@@ -0,0 +1,236 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Seed holds the inputs a SeedScheme derives a random number generator from.
+//
+// Fields:
+// - Secret: The seed secret, or nil for none.
+// - UserID: The ID of the user asking.
+// - Window: The start of the window the query falls into.
+// - Query: The query text as the user typed it.
+// - Normalize: The query normalization of schemes that normalize queries, or
+// nil for none.
+type Seed struct {
+	Secret    []byte
+	UserID    uint64
+	Window    time.Time
+	Query     string
+	Normalize func(string) string
+}
+
+// SeedScheme is a numbered, frozen algorithm turning the inputs of a query
+// into the random number generator its oracles draw from. A scheme must never
+// change once released: any change to it, however small, changes the answers
+// of every user, including those in the middle of a window. Improvements are
+// released as a new scheme with the next version instead, which operators opt
+// into with SEED_SCHEME.
+type SeedScheme interface {
+	// Version returns the number the scheme is selected with.
+	Version() int
+
+	// NewRand returns the random number generator for a query.
+	NewRand(seed Seed) *rand.Rand
+}
+
+// seedSchemes holds the released seed schemes keyed by version.
+var seedSchemes = map[int]SeedScheme{}
+
+// registerSeedScheme adds a scheme to seedSchemes. It panics if the version is
+// taken, since that is a programming error.
+//
+// Parameters:
+//   - s: The scheme to register.
+func registerSeedScheme(s SeedScheme) {
+	if _, ok := seedSchemes[s.Version()]; ok {
+		panic(fmt.Sprintf("seed scheme v%d registered twice", s.Version()))
+	}
+
+	seedSchemes[s.Version()] = s
+}
+
+func init() {
+	registerSeedScheme(seedSchemeV1{})
+	registerSeedScheme(seedSchemeV2{})
+	registerSeedScheme(seedSchemeV3{})
+}
+
+// defaultSeedScheme is the version used unless one is configured. It stays at
+// 1 so that upgrading pgb never changes answers by itself.
+const defaultSeedScheme = 1
+
+// getSeedScheme looks up a seed scheme by version.
+//
+// Parameters:
+//   - version: The version of the scheme.
+//
+// Returns:
+//   - The scheme.
+//   - An error listing the known versions if there is no such scheme.
+func getSeedScheme(version int) (SeedScheme, error) {
+	if s, ok := seedSchemes[version]; ok {
+		return s, nil
+	}
+
+	versions := make([]int, 0, len(seedSchemes))
+	for v := range seedSchemes {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+
+	return nil, fmt.Errorf("unknown seed scheme %d, known versions are %v", version, versions)
+}
+
+// minSeedSecretLen is the minimum length of a seed secret in bytes.
+const minSeedSecretLen = 16
+
+// seedSchemeV1 is the original derivation. A SHA-256 digest is taken over the
+// user ID and the Unix time of the window as little-endian integers, followed
+// by the query. With a secret it is an HMAC-SHA256 keyed with the secret
+// whose input starts with "pgb/hmac-sha256/v1". The digest is read as four
+// big-endian uint64 values, which are XORed into the seed of a math/rand
+// generator.
+type seedSchemeV1 struct{}
+
+// seedAlgorithmV1 names the keyed derivation of seedSchemeV1. It is hashed
+// before the inputs, so no other scheme produces the same digests.
+const seedAlgorithmV1 = "pgb/hmac-sha256/v1"
+
+func (seedSchemeV1) Version() int { return 1 }
+
+func (seedSchemeV1) NewRand(seed Seed) *rand.Rand {
+	h := newSeedHash(seed.Secret, seedAlgorithmV1)
+	_ = binary.Write(h, binary.LittleEndian, seed.UserID)
+	_ = binary.Write(h, binary.LittleEndian, seed.Window.Unix())
+	_ = binary.Write(h, binary.LittleEndian, []byte(seed.Query))
+	r := bytes.NewReader(h.Sum(nil))
+	seeds := make([]uint64, 4)
+	_ = binary.Read(r, binary.BigEndian, &seeds)
+
+	return newRand(seeds)
+}
+
+// newSeedHash returns the hash the seed inputs are written to. Without a
+// secret it is a plain SHA-256, whose answers anyone with the source can
+// compute. With a secret it is an HMAC-SHA256 keyed with the secret, starting
+// with the name of the algorithm.
+//
+// Parameters:
+//   - secret: The seed secret, or nil for none.
+//   - algorithm: The name and version of the keyed derivation.
+//
+// Returns:
+//   - The hash to write the seed inputs to.
+func newSeedHash(secret []byte, algorithm string) hash.Hash {
+	if len(secret) == 0 {
+		return sha256.New()
+	}
+
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte(algorithm))
+
+	return h
+}
+
+// seedSchemeV2 takes the same digest as seedSchemeV1, keyed with input
+// starting with "pgb/hmac-sha256/v2", and uses all 32 bytes of it as the seed
+// of a ChaCha8 generator from math/rand/v2. Unlike seedSchemeV1 it keeps the
+// full 256 bits of the digest, and it avoids the costly seeding of the
+// math/rand source.
+type seedSchemeV2 struct{}
+
+// seedAlgorithmV2 names the keyed derivation of seedSchemeV2.
+const seedAlgorithmV2 = "pgb/hmac-sha256/v2"
+
+func (seedSchemeV2) Version() int { return 2 }
+
+func (seedSchemeV2) NewRand(seed Seed) *rand.Rand {
+	return rand.New(chacha8Source{randv2.NewChaCha8(seedDigest(seed, seedAlgorithmV2))})
+}
+
+// seedDigest computes the digest of seedSchemeV1 without its intermediate
+// allocations: the user ID and the Unix time of the window as little-endian
+// integers, followed by the query.
+//
+// Parameters:
+//   - seed: The seed inputs.
+//   - algorithm: The name and version of the keyed derivation.
+//
+// Returns:
+//   - The 32-byte digest.
+func seedDigest(seed Seed, algorithm string) [sha256.Size]byte {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], seed.UserID)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(seed.Window.Unix()))
+
+	h := newSeedHash(seed.Secret, algorithm)
+	_, _ = h.Write(buf[:])
+	_, _ = h.Write([]byte(seed.Query))
+
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+
+	return digest
+}
+
+// seedSchemeV3 is seedSchemeV2 with the query normalized before it is
+// hashed, keyed with input starting with "pgb/hmac-sha256/v3". The answer
+// still shows the query as the user typed it.
+type seedSchemeV3 struct{}
+
+// seedAlgorithmV3 names the keyed derivation of seedSchemeV3.
+const seedAlgorithmV3 = "pgb/hmac-sha256/v3"
+
+func (seedSchemeV3) Version() int { return 3 }
+
+func (seedSchemeV3) NewRand(seed Seed) *rand.Rand {
+	if seed.Normalize != nil {
+		seed.Query = seed.Normalize(seed.Query)
+	}
+
+	return rand.New(chacha8Source{randv2.NewChaCha8(seedDigest(seed, seedAlgorithmV3))})
+}
+
+// chacha8Source adapts a math/rand/v2 ChaCha8 generator to the math/rand
+// Source64 interface, so that oracles keep drawing from a *rand.Rand whatever
+// the seed scheme.
+type chacha8Source struct {
+	*randv2.ChaCha8
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer.
+func (s chacha8Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Seed panics: a ChaCha8 generator is seeded with 32 bytes, not an int64.
+func (s chacha8Source) Seed(int64) {
+	panic("chacha8Source: cannot seed with an int64")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seedVector is a golden test vector of a seed scheme: the first random
+// numbers it yields for a seed, and the answers of the built-in oracles.
+type seedVector struct {
+	name   string
+	seed   Seed
+	rand   []uint64
+	divine string
+	pia    string
+}
+
+// seedVectorsV1 freeze seedSchemeV1. They must never be changed: a failure
+// means that the answers of every user pinned to v1 have changed.
+var seedVectorsV1 = []seedVector{
+	{
+		name:   "chinese query",
+		seed:   Seed{UserID: 42, Window: time.Unix(1715792400, 0), Query: "问题"},
+		rand:   []uint64{958324269436534551, 8793489208904483323, 39063620565710151, 3598708392899377123},
+		divine: "所求事项: 问题\n结果: 尚可",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ 问题",
+	},
+	{
+		name:   "zero values",
+		seed:   Seed{UserID: 0, Window: time.Unix(0, 0), Query: ""},
+		rand:   []uint64{4013356050288623377, 10826206750538664307, 5226235960245474110, 7428341741873915800},
+		divine: "所求事项: \n结果: 小凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ ",
+	},
+	{
+		name:   "english query",
+		seed:   Seed{UserID: 123456789, Window: time.Unix(1704067200, 0), Query: "Will it rain tomorrow?"},
+		rand:   []uint64{3925173970966588789, 10127661008650896304, 6395878219404120214, 4468145648353980778},
+		divine: "所求事项: Will it rain tomorrow?\n结果: 甚大凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ Will it rain tomorrow?",
+	},
+	{
+		name:   "keyed",
+		seed:   Seed{Secret: []byte("0123456789abcdef"), UserID: 42, Window: time.Unix(1715792400, 0), Query: "问题"},
+		rand:   []uint64{1373503225552439637, 868818270902239800, 2921395484915528729, 4556132201152522285},
+		divine: "所求事项: 问题\n结果: 凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ 问题",
+	},
+	{
+		name:   "keyed english query",
+		seed:   Seed{Secret: []byte("another secret key"), UserID: 123456789, Window: time.Unix(1704067200, 0), Query: "Will it rain tomorrow?"},
+		rand:   []uint64{11070914780156991711, 2769854039536685208, 13818880852270708834, 10720520971309569059},
+		divine: "所求事项: Will it rain tomorrow?\n结果: 甚小吉",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ Will it rain tomorrow?",
+	},
+}
+
+// seedVectorsV2 freeze seedSchemeV2 for the seeds of seedVectorsV1.
+var seedVectorsV2 = []seedVector{
+	{
+		name:   "chinese query",
+		seed:   seedVectorsV1[0].seed,
+		rand:   []uint64{14405572317015763076, 16183989668787584666, 39766729776416958, 7187867483340483025},
+		divine: "所求事项: 问题\n结果: 大凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ 问题",
+	},
+	{
+		name:   "zero values",
+		seed:   seedVectorsV1[1].seed,
+		rand:   []uint64{10926005887484376509, 6611044975575816012, 5794951132764492429, 13255016958245474557},
+		divine: "所求事项: \n结果: 大吉",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ ",
+	},
+	{
+		name:   "english query",
+		seed:   seedVectorsV1[2].seed,
+		rand:   []uint64{7562917255368161097, 9838841229297548067, 10147417774995635933, 6620760714449476221},
+		divine: "所求事项: Will it rain tomorrow?\n结果: 大吉",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ Will it rain tomorrow?",
+	},
+	{
+		name:   "keyed",
+		seed:   seedVectorsV1[3].seed,
+		rand:   []uint64{4380972473618396688, 13543364359622669123, 3602933416575036294, 11618569687138199158},
+		divine: "所求事项: 问题\n结果: 大凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ 问题",
+	},
+	{
+		name:   "keyed english query",
+		seed:   seedVectorsV1[4].seed,
+		rand:   []uint64{15665477565492795317, 15455492127268090948, 16413034222310322364, 13929309884635975497},
+		divine: "所求事项: Will it rain tomorrow?\n结果: 甚小凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ Will it rain tomorrow?",
+	},
+}
+
+// seedVectorsV3 freeze seedSchemeV3 with every normalization step. The first
+// two queries normalize to the same text and so get the same answer, while the
+// answer still shows the query as typed.
+var seedVectorsV3 = []seedVector{
+	{
+		name:   "chinese query",
+		seed:   Seed{UserID: 42, Window: time.Unix(1715792400, 0), Query: "明天会下雨吗", Normalize: defaultQueryNormalizer.Normalize},
+		rand:   []uint64{11482397412891860433, 11318591519295069788, 17015139075952874563, 17043434090514307782},
+		divine: "所求事项: 明天会下雨吗\n结果: 凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ 明天会下雨吗",
+	},
+	{
+		name:   "chinese query with punctuation and spaces",
+		seed:   Seed{UserID: 42, Window: time.Unix(1715792400, 0), Query: "  明天会下雨吗？ ", Normalize: defaultQueryNormalizer.Normalize},
+		rand:   []uint64{11482397412891860433, 11318591519295069788, 17015139075952874563, 17043434090514307782},
+		divine: "所求事项:   明天会下雨吗？ \n结果: 凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆   明天会下雨吗？ ",
+	},
+	{
+		name:   "full-width english query",
+		seed:   Seed{UserID: 123456789, Window: time.Unix(1704067200, 0), Query: "Ｗｉｌｌ  it RAIN tomorrow?!", Normalize: defaultQueryNormalizer.Normalize},
+		rand:   []uint64{14737234202943179106, 5825811796485985335, 4005380201429967801, 17785896653860868971},
+		divine: "所求事项: Ｗｉｌｌ  it RAIN tomorrow?!\n结果: 特小凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ Ｗｉｌｌ  it RAIN tomorrow?!",
+	},
+	{
+		name:   "keyed",
+		seed:   Seed{Secret: []byte("0123456789abcdef"), UserID: 42, Window: time.Unix(1715792400, 0), Query: "明天会下雨吗", Normalize: defaultQueryNormalizer.Normalize},
+		rand:   []uint64{13928487876321182273, 10848430501259731985, 1937759344987378041, 16661459853555358612},
+		divine: "所求事项: 明天会下雨吗\n结果: 特小凶",
+		pia:    "Pia!<(=ｏ ‵-′)ノ☆ 明天会下雨吗",
+	},
+}
+
+// testSeedVectors checks a scheme against its golden vectors, both for the
+// raw random numbers and for the answers of divine followed by pia on a
+// shared context, which also freezes the order in which they draw.
+func testSeedVectors(t *testing.T, scheme SeedScheme, vectors []seedVector) {
+	t.Helper()
+
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			r := scheme.NewRand(v.seed)
+			for i, want := range v.rand {
+				assert.Equal(t, want, r.Uint64(), "value %d", i)
+			}
+
+			rctx := buildUpdateContextAt(scheme, v.seed, "zh")
+			rctx.Settings = currentSettings()
+			assert.Equal(t, v.divine, divine(rctx))
+			assert.Equal(t, v.pia, pia(rctx))
+		})
+	}
+}
+
+func TestSeedSchemeV1Vectors(t *testing.T) {
+	testSeedVectors(t, seedSchemeV1{}, seedVectorsV1)
+}
+
+func TestSeedSchemeV2Vectors(t *testing.T) {
+	testSeedVectors(t, seedSchemeV2{}, seedVectorsV2)
+}
+
+func TestSeedSchemeV3Vectors(t *testing.T) {
+	testSeedVectors(t, seedSchemeV3{}, seedVectorsV3)
+}
+
+func TestSeedSchemeV3WithoutNormalization(t *testing.T) {
+	// Without normalization the scheme hashes the query as typed.
+	seed := seedVectorsV3[1].seed
+	seed.Normalize = nil
+
+	assert.NotEqual(t, seedVectorsV3[1].rand[0], seedSchemeV3{}.NewRand(seed).Uint64())
+}
+
+func TestSeedDigestMatchesV1(t *testing.T) {
+	// seedDigest encodes the inputs exactly like seedSchemeV1, so feeding
+	// its digest through the v1 generator reproduces the v1 vectors.
+	for _, v := range seedVectorsV1 {
+		digest := seedDigest(v.seed, seedAlgorithmV1)
+		seeds := make([]uint64, 4)
+		assert.NoError(t, binary.Read(bytes.NewReader(digest[:]), binary.BigEndian, &seeds))
+		assert.Equal(t, v.rand[0], newRand(seeds).Uint64(), v.name)
+	}
+}
+
+func TestChaCha8Source(t *testing.T) {
+	r := seedSchemeV2{}.NewRand(seedVectorsV1[0].seed)
+
+	for range 100 {
+		assert.GreaterOrEqual(t, r.Int63(), int64(0))
+	}
+
+	assert.Panics(t, func() { r.Seed(1) })
+}
+
+func TestSeedSchemesHaveVectors(t *testing.T) {
+	vectors := map[int][]seedVector{
+		1: seedVectorsV1,
+		2: seedVectorsV2,
+		3: seedVectorsV3,
+	}
+
+	for version, scheme := range seedSchemes {
+		assert.Equal(t, version, scheme.Version())
+		assert.NotEmpty(t, vectors[version], "seed scheme v%d has no golden vectors", version)
+	}
+}
+
+func TestGetSeedScheme(t *testing.T) {
+	s, err := getSeedScheme(1)
+	assert.NoError(t, err)
+	assert.Equal(t, seedSchemeV1{}, s)
+
+	_, err = getSeedScheme(0)
+	assert.Error(t, err)
+
+	_, err = getSeedScheme(99)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "[1 2 3]")
+	}
+
+	assert.Panics(t, func() { registerSeedScheme(seedSchemeV1{}) })
+}
+
+func TestSettingsSeedScheme(t *testing.T) {
+	s, err := newSettings(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultSeedScheme, s.seedScheme.Version())
+
+	s, err = newSettings(&Config{SeedScheme: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.seedScheme.Version())
+
+	_, err = newSettings(&Config{SeedScheme: 99})
+	assert.Error(t, err)
+}
+
+// BenchmarkSeedScheme measures the cost of deriving the generator of a query
+// and drawing the first number from it.
+func BenchmarkSeedScheme(b *testing.B) {
+	for _, scheme := range []SeedScheme{seedSchemeV1{}, seedSchemeV2{}, seedSchemeV3{}} {
+		for _, v := range []seedVector{seedVectorsV3[1], seedVectorsV3[3]} {
+			b.Run(fmt.Sprintf("v%d/%s", scheme.Version(), v.name), func(b *testing.B) {
+				b.ReportAllocs()
+
+				for b.Loop() {
+					scheme.NewRand(v.seed).Uint64()
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkSeedSchemeDraw measures the throughput of the generator of a query
+// once it has been derived.
+func BenchmarkSeedSchemeDraw(b *testing.B) {
+	for _, scheme := range []SeedScheme{seedSchemeV1{}, seedSchemeV2{}} {
+		b.Run(fmt.Sprintf("v%d", scheme.Version()), func(b *testing.B) {
+			r := scheme.NewRand(seedVectorsV1[0].seed)
+			b.ReportAllocs()
+			b.SetBytes(8)
+
+			for b.Loop() {
+				r.Uint64()
+			}
+		})
+	}
+}
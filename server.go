@@ -0,0 +1,339 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// inflight tracks update handlers that are still running so that shutdown can
+// wait for them. Handlers run on their own context, which is only cancelled
+// once the grace period is over, so that an AnswerInlineQuery call started
+// before a signal still reaches Telegram.
+type inflight struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	count int
+	idle  *sync.Cond
+}
+
+// newInflight creates an inflight tracker with no running handlers.
+//
+// Returns:
+//   - A pointer to a new inflight tracker.
+func newInflight() *inflight {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &inflight{ctx: ctx, cancel: cancel}
+	f.idle = sync.NewCond(&f.mu)
+
+	return f
+}
+
+// Middleware wraps an update handler so that it is counted while it runs and
+// receives the tracker's context instead of the update worker's. Updates
+// received by Webhook are counted from the moment they are acknowledged.
+//
+// Parameters:
+//   - next: The handler to wrap.
+//
+// Returns:
+//   - The wrapped handler.
+func (f *inflight) Middleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if ctx.Value(acceptedKey{}) == nil {
+			f.mu.Lock()
+			f.count++
+			f.mu.Unlock()
+		}
+
+		defer func() {
+			f.mu.Lock()
+			f.count--
+			if f.count == 0 {
+				f.idle.Broadcast()
+			}
+			f.mu.Unlock()
+		}()
+
+		next(f.ctx, b, update)
+	}
+}
+
+// acceptedKey marks the context of an update that Webhook has already counted.
+type acceptedKey struct{}
+
+// Webhook returns the handler receiving updates from Telegram in webhook mode.
+// It replaces the bot's own handler, which queues updates in a channel whose
+// contents are lost when its workers stop, although Telegram has already been
+// told that they arrived. Here an update is counted before it is acknowledged,
+// so Drain waits for it like for a running handler.
+//
+// Parameters:
+//   - b: The bot processing the updates.
+//   - secret: The secret token Telegram must send, or "" to accept any
+//     request.
+//
+// Returns:
+//   - The webhook handler.
+func (f *inflight) Webhook(b *bot.Bot, secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := req.Header.Get(webhookSecretHeader)
+		if secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			slog.Warn("webhook request with an invalid secret token")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		update := &models.Update{}
+		if err := json.NewDecoder(req.Body).Decode(update); err != nil {
+			slog.Error("decode webhook request", slog.Any("error", err))
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+			return
+		}
+
+		f.mu.Lock()
+		f.count++
+		f.mu.Unlock()
+
+		b.ProcessUpdate(context.WithValue(context.Background(), acceptedKey{}, true), update)
+	})
+}
+
+// Drain waits until no handler is running or the context is done, whichever
+// comes first. Handlers still running at that point are cancelled.
+//
+// Parameters:
+//   - ctx: The context bounding the grace period.
+//
+// Returns:
+//   - An error if handlers had to be cancelled, or nil if all finished in time.
+func (f *inflight) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		f.mu.Lock()
+		for f.count > 0 {
+			f.idle.Wait()
+		}
+		f.mu.Unlock()
+		close(done)
+	}()
+
+	defer f.cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("drain update handlers: %w", ctx.Err())
+	}
+}
+
+// newHTTPServer creates the HTTP server listening on the configured host and
+// port with the configured timeouts.
+//
+// Parameters:
+//   - conf: The application configuration.
+//   - h: The handler serving all requests.
+//
+// Returns:
+//   - A pointer to a new, not yet started http.Server.
+func newHTTPServer(conf *Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         net.JoinHostPort(conf.Host, conf.Port),
+		Handler:      h,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+		IdleTimeout:  conf.IdleTimeout,
+	}
+}
+
+// newBot creates the bot with the handlers and options derived from the
+// configuration. It calls getMe, so a nil error also means the token has been
+// accepted by Telegram, and commands addressed to other bots are ignored by
+// the username it returns.
+//
+// Parameters:
+//   - conf: The application configuration.
+//   - work: The tracker of running update handlers.
+//
+// Returns:
+//   - A pointer to the new bot instance.
+//   - An error if the bot could not be created.
+func newBot(conf *Config, work *inflight) (*bot.Bot, error) {
+	// username is set before newBot returns, and so before any update is
+	// processed.
+	var username string
+
+	opts := []bot.Option{
+		bot.WithDefaultHandler(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			handler(ctx, b, update, username)
+		}),
+		bot.WithSkipGetMe(),
+		bot.WithAllowedUpdates(allowedUpdates),
+		bot.WithMiddlewares(work.Middleware, logUpdate),
+		bot.WithErrorsHandler(botErrorsHandler),
+		bot.WithDebugHandler(botDebugHandler),
+	}
+
+	if conf.Debug {
+		opts = append(opts, bot.WithDebug())
+	}
+
+	b, err := bot.New(conf.Token, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+	defer cancel()
+
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get bot user: %w", err)
+	}
+
+	username = me.Username
+
+	return b, nil
+}
+
+// run starts the HTTP server, connects to Telegram and processes updates until
+// the context is cancelled.
+//
+// The HTTP server always serves the health, readiness, version and metrics
+// endpoints and, in webhook mode, the webhook itself. Its port is bound before
+// the bot is created, so that pgb fails without touching the webhook when the
+// port is taken, and liveness can be probed while the getMe check is running;
+// readiness only passes once the bot is up.
+//
+// In webhook mode the webhook is registered on startup when a webhook URL is
+// configured, watched for drift and optionally deleted again on shutdown. In
+// polling mode any existing webhook is deleted first, because Telegram refuses
+// getUpdates while a webhook is set.
+//
+// Once the context is cancelled the server stops accepting connections, and
+// pending requests and update handlers, including those of updates
+// acknowledged but not yet started, get the shutdown grace period to finish.
+//
+// Parameters:
+//   - ctx: The context whose cancellation starts the shutdown.
+//   - conf: The application configuration.
+//
+// Returns:
+//   - An error if the server could not listen or the bot could not be set up,
+//     or nil after a clean shutdown.
+func run(ctx context.Context, conf *Config) error {
+	work := newInflight()
+	st := &status{}
+
+	mux := http.NewServeMux()
+	st.Register(mux)
+	mux.Handle("GET "+metricsPath, registry)
+
+	srv := newHTTPServer(conf, mux)
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("http server: %w", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+
+	b, err := newBot(conf, work)
+	if err != nil {
+		srv.Close()
+		return err
+	}
+
+	switch conf.Mode {
+	case ModePolling:
+		if _, err := b.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+			srv.Close()
+			return fmt.Errorf("delete webhook: %w", err)
+		}
+
+		go b.Start(ctx)
+	default:
+		if conf.WebhookURL != "" {
+			if err := setWebhook(ctx, b, conf); err != nil {
+				srv.Close()
+				return err
+			}
+
+			go watchWebhook(ctx, b, conf)
+		}
+
+		mux.Handle("/", instrumentWebhook(work.Webhook(b, conf.WebhookSecret)))
+	}
+
+	st.SetReady(true)
+
+	slog.Info("pgb started",
+		slog.String("version", getBuildInfo().Version),
+		slog.String("mode", conf.Mode),
+		slog.String("addr", srv.Addr))
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("http server: %w", err)
+	case <-ctx.Done():
+	}
+
+	st.SetReady(false)
+
+	slog.Info("shutting down", slog.Duration("grace_period", conf.ShutdownTimeout))
+
+	sctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(sctx); err != nil {
+		slog.Error("http server shutdown", slog.Any("error", err))
+	}
+
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("http server", slog.Any("error", err))
+	}
+
+	if err := work.Drain(sctx); err != nil {
+		slog.Warn("shutdown", slog.Any("error", err))
+	}
+
+	if conf.Mode == ModeWebhook && conf.WebhookURL != "" && conf.WebhookDelete {
+		deleteWebhook(b, conf.Timeout)
+	}
+
+	return nil
+}
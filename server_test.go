@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightDrainWaitsForHandlers(t *testing.T) {
+	work := newInflight()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var handlerErr error
+	h := work.Middleware(func(ctx context.Context, _ *bot.Bot, _ *models.Update) {
+		close(started)
+		<-release
+		handlerErr = ctx.Err()
+	})
+
+	workerCtx, cancelWorker := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		h(workerCtx, nil, &models.Update{})
+		close(finished)
+	}()
+	<-started
+
+	// Cancelling the worker context must not cancel the running handler.
+	cancelWorker()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, work.Drain(ctx))
+	<-finished
+	assert.NoError(t, handlerErr)
+}
+
+func TestInflightDrainCancelsAfterGracePeriod(t *testing.T) {
+	work := newInflight()
+	started := make(chan struct{})
+	finished := make(chan struct{})
+
+	h := work.Middleware(func(ctx context.Context, _ *bot.Bot, _ *models.Update) {
+		close(started)
+		<-ctx.Done()
+		close(finished)
+	})
+
+	go h(context.Background(), nil, &models.Update{})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Error(t, work.Drain(ctx))
+	<-finished
+}
+
+func TestInflightDrainIdle(t *testing.T) {
+	work := newInflight()
+	assert.NoError(t, work.Drain(context.Background()))
+}
+
+// postUpdate sends a webhook request to a handler and returns the status.
+func postUpdate(h http.Handler, secret, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(webhookSecretHeader, secret)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestInflightWebhookRejects(t *testing.T) {
+	work := newInflight()
+	b, err := bot.New("123456:test", bot.WithSkipGetMe(), bot.WithMiddlewares(work.Middleware))
+	require.NoError(t, err)
+
+	h := work.Webhook(b, "secret")
+	assert.Equal(t, http.StatusUnauthorized, postUpdate(h, "wrong", `{"update_id": 1}`))
+	assert.Equal(t, http.StatusBadRequest, postUpdate(h, "secret", `{`))
+	assert.NoError(t, work.Drain(context.Background()), "rejected requests are not counted")
+}
+
+func TestInflightDrainWaitsForAcknowledgedUpdates(t *testing.T) {
+	work := newInflight()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handled := make(chan int64, 1)
+
+	b, err := bot.New("123456:test",
+		bot.WithSkipGetMe(),
+		bot.WithMiddlewares(work.Middleware),
+		bot.WithDefaultHandler(func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+			close(started)
+			<-release
+			if ctx.Err() == nil {
+				handled <- update.ID
+			}
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, postUpdate(work.Webhook(b, "secret"), "secret", `{"update_id": 7}`))
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		drained <- work.Drain(ctx)
+	}()
+
+	<-started
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while an acknowledged update was being handled")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	assert.NoError(t, <-drained)
+	assert.Equal(t, int64(7), <-handled)
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	conf := &Config{
+		Host:         "127.0.0.1",
+		Port:         "8080",
+		ReadTimeout:  time.Second,
+		WriteTimeout: 2 * time.Second,
+		IdleTimeout:  3 * time.Second,
+	}
+	srv := newHTTPServer(conf, nil)
+	assert.Equal(t, "127.0.0.1:8080", srv.Addr)
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 3*time.Second, srv.IdleTimeout)
+}
+
+func TestRunPortTaken(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+
+	// The port is checked before the bot is created, so the unreachable
+	// Telegram API and webhook are never contacted.
+	conf := &Config{
+		Host:       host,
+		Port:       port,
+		Mode:       ModeWebhook,
+		Token:      "123:abc",
+		WebhookURL: "https://example.com/hook",
+	}
+
+	err = run(context.Background(), conf)
+	assert.ErrorContains(t, err, "http server")
+}
@@ -0,0 +1,439 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultLocale is the key of the configured title used for locales without
+// a title of their own.
+const defaultLocale = "default"
+
+// reloadableKeys lists the configuration keys that take effect on reload.
+// Changes to any other key are reported and ignored until restart.
+var reloadableKeys = map[string]bool{
+	"oracles":    true,
+	"titles":     true,
+	"tables":     true,
+	"window":     true,
+	"windows":    true,
+	"timezone":   true,
+	"log_level":  true,
+	"log_format": true,
+
+	"seed_secret":      true,
+	"seed_secret_file": true,
+	"seed_scheme":      true,
+
+	"query_normalization": true,
+
+	"lingqian_file": true,
+}
+
+// settings holds the part of the configuration that can change at runtime.
+// A settings value is never modified after it has been published, so readers
+// may keep using it while a reload installs a new one.
+type settings struct {
+	oracles     []Oracle
+	titles      map[string]map[string]string
+	omens       *WeightedTable[string]
+	multipliers *WeightedTable[string]
+	window      Window
+	windows     map[string]Window
+	location    *time.Location
+	seedSecret  []byte
+	seedScheme  SeedScheme
+	normalizer  *queryNormalizer
+	lingqian    *lingqianSet
+}
+
+// live holds the settings currently in use.
+var live atomic.Pointer[settings]
+
+// newSettings derives the runtime settings from a configuration.
+//
+// Parameters:
+//   - conf: The configuration.
+//
+// Returns:
+//   - A pointer to the new settings.
+//   - An error if the configuration refers to unknown oracles or contains an
+//     invalid outcome table, timezone, seed scheme or normalization step, or
+//     if the fortune stick file cannot be loaded.
+func newSettings(conf *Config) (*settings, error) {
+	enabled, err := oracles.Select(conf.Oracles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ORACLES: %w", err)
+	}
+
+	titles := make(map[string]map[string]string, len(conf.Titles))
+	for oracle, locales := range conf.Titles {
+		titles[oracle] = maps.Clone(locales)
+	}
+
+	tables, err := newTables(conf.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := time.LoadLocation(conf.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIMEZONE %q: %w", conf.Timezone, err)
+	}
+
+	version := conf.SeedScheme
+	if version == 0 {
+		version = defaultSeedScheme
+	}
+
+	scheme, err := getSeedScheme(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SEED_SCHEME: %w", err)
+	}
+
+	normalizer, err := newQueryNormalizer(conf.QueryNormalization)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUERY_NORMALIZATION: %w", err)
+	}
+
+	window := conf.Window
+	if window.IsZero() {
+		window = defaultWindow
+	}
+
+	lingqian := defaultLingqian
+	if conf.LingqianFile != "" {
+		if lingqian, err = loadLingqianSet(conf.LingqianFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return &settings{
+		oracles:     enabled,
+		titles:      titles,
+		omens:       tables[tableOmen],
+		multipliers: tables[tableMultiplier],
+		window:      window,
+		windows:     maps.Clone(conf.Windows),
+		location:    location,
+		seedSecret:  []byte(conf.SeedSecret),
+		seedScheme:  scheme,
+		normalizer:  normalizer,
+		lingqian:    lingqian,
+	}, nil
+}
+
+// Names of the outcome tables that can be configured.
+const (
+	tableOmen       = "omen"
+	tableMultiplier = "multiplier"
+)
+
+// defaultTables returns the built-in outcome tables keyed by name.
+//
+// Returns:
+//   - A new map holding every configurable table.
+func defaultTables() map[string]*WeightedTable[string] {
+	return map[string]*WeightedTable[string]{
+		tableOmen:       defaultOmens,
+		tableMultiplier: defaultMultipliers,
+	}
+}
+
+// newTables builds the outcome tables in use from the configured ones. Tables
+// that are not configured keep their built-in entries.
+//
+// Parameters:
+//   - configured: The configured tables keyed by name.
+//
+// Returns:
+//   - Every configurable table keyed by name.
+//   - An error if a table is unknown or invalid.
+func newTables(configured map[string][]Weighted[string]) (map[string]*WeightedTable[string], error) {
+	tables := defaultTables()
+
+	for name, entries := range configured {
+		if _, ok := tables[name]; !ok {
+			return nil, fmt.Errorf("invalid tables: unknown table %q", name)
+		}
+
+		t, err := NewWeightedTable(entries)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tables: %s: %w", name, err)
+		}
+
+		tables[name] = t
+	}
+
+	return tables, nil
+}
+
+// currentSettings returns the settings currently in use, or the built-in
+// defaults if none have been installed.
+//
+// Returns:
+//   - A pointer to the live settings.
+func currentSettings() *settings {
+	if s := live.Load(); s != nil {
+		return s
+	}
+
+	return &settings{
+		oracles:     oracles.All(),
+		omens:       defaultOmens,
+		multipliers: defaultMultipliers,
+		window:      defaultWindow,
+		location:    time.UTC,
+		seedScheme:  seedSchemes[defaultSeedScheme],
+		normalizer:  defaultQueryNormalizer,
+		lingqian:    defaultLingqian,
+	}
+}
+
+// windowOf returns the window of an oracle. A window configured for the
+// oracle takes precedence over the oracle's built-in window, which in turn
+// takes precedence over the configured default window.
+//
+// Parameters:
+//   - o: The oracle.
+//
+// Returns:
+//   - The oracle's window.
+func (s *settings) windowOf(o Oracle) Window {
+	if w, ok := s.windows[o.ID()]; ok {
+		return w
+	}
+
+	if w, ok := o.(Windowed); ok {
+		return w.Window()
+	}
+
+	return s.window
+}
+
+// title returns the title of an oracle's result for a locale. A title
+// configured for the locale takes precedence over one configured for the
+// default locale, which in turn takes precedence over the oracle's built-in
+// title.
+//
+// Parameters:
+//   - o: The oracle.
+//   - locale: The user's language code.
+//
+// Returns:
+//   - The localized title.
+func (s *settings) title(o Oracle, locale string) string {
+	if t, ok := s.titles[o.ID()][locale]; ok {
+		return t
+	}
+
+	if t, ok := s.titles[o.ID()][defaultLocale]; ok {
+		return t
+	}
+
+	return o.Title(locale)
+}
+
+// localized reports whether the inline result of an oracle reads differently
+// in different locales, through a title configured for a particular locale or
+// through its built-in title or description, which only ever tell "zh" apart.
+//
+// Parameters:
+//   - o: The oracle.
+//
+// Returns:
+//   - true if users with different locales may see different results.
+func (s *settings) localized(o Oracle) bool {
+	for locale := range s.titles[o.ID()] {
+		if locale != defaultLocale {
+			return true
+		}
+	}
+
+	return o.Title("zh") != o.Title("") || o.Description("zh") != o.Description("")
+}
+
+// validateTitles checks that configured titles only refer to known oracles
+// and are not empty.
+//
+// Parameters:
+//   - titles: The configured titles, keyed by oracle and then by locale.
+//
+// Returns:
+//   - An error describing the first invalid title, or nil.
+func validateTitles(titles map[string]map[string]string) error {
+	for oracle, locales := range titles {
+		if _, ok := oracles.Get(oracle); !ok {
+			return fmt.Errorf("invalid titles: unknown oracle %q", oracle)
+		}
+
+		for locale, title := range locales {
+			if strings.TrimSpace(title) == "" {
+				return fmt.Errorf("invalid titles: empty title for %s in locale %q", oracle, locale)
+			}
+		}
+	}
+
+	return nil
+}
+
+// restartRequired lists the configuration keys that differ between two
+// configurations but only take effect after a restart.
+//
+// Parameters:
+//   - prev: The configuration in use.
+//   - next: The newly loaded configuration.
+//
+// Returns:
+//   - The YAML keys of the changed settings that cannot be reloaded.
+func restartRequired(prev, next *Config) []string {
+	var keys []string
+
+	pv := reflect.ValueOf(prev).Elem()
+	nv := reflect.ValueOf(next).Elem()
+	t := pv.Type()
+
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if reloadableKeys[key] {
+			continue
+		}
+
+		if !reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// keepRestartRequired returns a copy of the newly loaded configuration in
+// which the settings that only take effect after a restart keep the values in
+// use, so that it describes the running process. Otherwise the logger would
+// redact a new token the bot does not use yet, DEBUG would change the log
+// level without re-creating the bot, and the next reload would no longer
+// report the pending changes.
+//
+// Parameters:
+//   - prev: The configuration in use.
+//   - next: The newly loaded configuration.
+//
+// Returns:
+//   - The configuration to apply.
+func keepRestartRequired(prev, next *Config) *Config {
+	merged := *next
+
+	pv := reflect.ValueOf(prev).Elem()
+	mv := reflect.ValueOf(&merged).Elem()
+	t := pv.Type()
+
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if !reloadableKeys[key] {
+			mv.Field(i).Set(pv.Field(i))
+		}
+	}
+
+	return &merged
+}
+
+// applySettings installs the runtime settings and logger described by the
+// configuration.
+//
+// Parameters:
+//   - conf: The validated configuration.
+//
+// Returns:
+//   - An error if the settings or the logger cannot be set up.
+func applySettings(conf *Config) error {
+	s, err := newSettings(conf)
+	if err != nil {
+		return err
+	}
+
+	if err := setupLogging(conf); err != nil {
+		return err
+	}
+
+	live.Store(s)
+
+	return nil
+}
+
+// reloadConfig loads the configuration again and, if it is valid, swaps in the
+// new runtime settings. An invalid configuration is logged and leaves the
+// previous settings in place.
+//
+// Parameters:
+//   - load: The function loading and validating the configuration.
+//   - prev: The configuration currently in use.
+//
+// Returns:
+//   - The configuration in use after the reload attempt, in which settings
+//     that require a restart keep their previous values.
+func reloadConfig(load func() (*Config, error), prev *Config) *Config {
+	next, err := load()
+	if err != nil {
+		slog.Error("reload configuration, keeping the previous one", slog.Any("error", err))
+		return prev
+	}
+
+	keys := restartRequired(prev, next)
+	next = keepRestartRequired(prev, next)
+
+	if err := applySettings(next); err != nil {
+		slog.Error("reload configuration, keeping the previous one", slog.Any("error", err))
+		return prev
+	}
+
+	if len(keys) > 0 {
+		slog.Warn("configuration changes require a restart", slog.Any("keys", keys))
+	}
+
+	slog.Info("configuration reloaded")
+
+	return next
+}
+
+// watchReload reloads the configuration whenever a signal arrives on hup,
+// until the context is cancelled. The caller subscribes hup to SIGHUP before
+// serving starts, since until then SIGHUP would terminate the process.
+//
+// Parameters:
+//   - ctx: The context controlling the lifetime of the watcher.
+//   - hup: The channel receiving SIGHUP.
+//   - load: The function loading and validating the configuration.
+//   - conf: The configuration in use when the watcher starts.
+func watchReload(ctx context.Context, hup <-chan os.Signal, load func() (*Config, error), conf *Config) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			conf = reloadConfig(load, conf)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSettings returns the default settings with the given oracles enabled.
+func testSettings(t *testing.T, enabled ...Oracle) *settings {
+	t.Helper()
+
+	s, err := newSettings(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.oracles = enabled
+
+	return s
+}
+
+func TestSettingsTitle(t *testing.T) {
+	s, err := newSettings(&Config{Titles: map[string]map[string]string{
+		"divine": {"en": "Oracle", "ja": "おみくじ"},
+		"pia":    {defaultLocale: "Slap"},
+	}})
+	assert.NoError(t, err)
+
+	var d, p Oracle = divineOracle{}, piaOracle{}
+	assert.Equal(t, "求签", s.title(d, "zh"))
+	assert.Equal(t, "Oracle", s.title(d, "en"))
+	assert.Equal(t, "おみくじ", s.title(d, "ja"))
+	assert.Equal(t, "Divination", s.title(d, "fr"))
+	assert.Equal(t, "Slap", s.title(p, "zh"))
+}
+
+func TestSettingsOracles(t *testing.T) {
+	s, err := newSettings(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, oracles.All(), s.oracles)
+
+	s, err = newSettings(&Config{Oracles: []string{"pia"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []Oracle{piaOracle{}}, s.oracles)
+
+	_, err = newSettings(&Config{Oracles: []string{"nonexistent"}})
+	assert.Error(t, err)
+}
+
+func TestValidateTitles(t *testing.T) {
+	assert.NoError(t, validateTitles(nil))
+	assert.NoError(t, validateTitles(map[string]map[string]string{"divine": {"en": "Oracle"}}))
+	assert.Error(t, validateTitles(map[string]map[string]string{"nonexistent": {"en": "Oracle"}}))
+	assert.Error(t, validateTitles(map[string]map[string]string{"pia": {"en": " "}}))
+}
+
+func TestRestartRequired(t *testing.T) {
+	prev := testConfig(t)
+	next := prev
+
+	assert.Empty(t, restartRequired(&prev, &next))
+
+	next.LogLevel = "debug"
+	next.Titles = map[string]map[string]string{"pia": {"en": "Slap"}}
+	assert.Empty(t, restartRequired(&prev, &next))
+
+	next.Port = "9000"
+	next.Mode = ModePolling
+	assert.Equal(t, []string{"mode", "port"}, restartRequired(&prev, &next))
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	defer live.Store(live.Load())
+
+	prev := testConfig(t)
+	prev.LogLevel = "error"
+	assert.NoError(t, applySettings(&prev))
+
+	next := prev
+	next.Titles = map[string]map[string]string{"divine": {"zh": "灵签"}}
+
+	conf := reloadConfig(func() (*Config, error) { return &next, nil }, &prev)
+	assert.Equal(t, next, *conf)
+	assert.Equal(t, "灵签", currentSettings().title(divineOracle{}, "zh"))
+
+	failed := reloadConfig(func() (*Config, error) { return nil, errors.New("bad config") }, conf)
+	assert.Same(t, conf, failed)
+	assert.Equal(t, "灵签", currentSettings().title(divineOracle{}, "zh"))
+}
+
+func TestReloadConfigKeepsRestartRequired(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	defer live.Store(live.Load())
+
+	prev := testConfig(t)
+	prev.LogLevel = "error"
+	assert.NoError(t, applySettings(&prev))
+
+	next := prev
+	next.Token = "9876543210:changed"
+	next.Debug = true
+	next.Port = "9000"
+	next.LogFormat = "text"
+
+	conf := reloadConfig(func() (*Config, error) { return &next, nil }, &prev)
+	assert.Equal(t, prev.Token, conf.Token)
+	assert.False(t, conf.Debug)
+	assert.Equal(t, prev.Port, conf.Port)
+	assert.Equal(t, "text", conf.LogFormat)
+
+	// The pending changes are reported again on the next reload.
+	assert.Equal(t, []string{"debug", "port", "token"}, restartRequired(conf, &next))
+}
+
+func TestSettingsTables(t *testing.T) {
+	s, err := newSettings(&Config{})
+	assert.NoError(t, err)
+	assert.Same(t, defaultOmens, s.omens)
+	assert.Same(t, defaultMultipliers, s.multipliers)
+
+	s, err = newSettings(&Config{Tables: map[string][]Weighted[string]{
+		tableOmen: {{Label: "大吉", Weight: 1}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "大吉", s.omens.Sample(12345))
+	assert.Same(t, defaultMultipliers, s.multipliers)
+
+	_, err = newSettings(&Config{Tables: map[string][]Weighted[string]{
+		"luck": {{Label: "a", Weight: 1}},
+	}})
+	assert.Error(t, err)
+
+	_, err = newSettings(&Config{Tables: map[string][]Weighted[string]{
+		tableMultiplier: {{Label: "a", Weight: 0}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestDivineUsesConfiguredTables(t *testing.T) {
+	s, err := newSettings(&Config{Tables: map[string][]Weighted[string]{
+		tableOmen:       {{Label: "吉", Weight: 1}},
+		tableMultiplier: {{Label: "大", Weight: 1}},
+	}})
+	assert.NoError(t, err)
+
+	// The tables come from the context, not from the live settings.
+	rctx := buildUpdateContextAt(s.seedScheme, Seed{UserID: 42, Query: "问题"}, "zh")
+	rctx.Settings = s
+	assert.Equal(t, "所求事项: 问题\n结果: 大吉", divine(rctx))
+}
+
+func TestSettingsSeedSecret(t *testing.T) {
+	plain := testSettings(t, divineOracle{}, piaOracle{})
+	keyed, err := newSettings(&Config{SeedSecret: "0123456789abcdef"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef"), keyed.seedSecret)
+
+	now := time.Date(2024, time.May, 15, 17, 10, 0, 0, time.UTC)
+	want := buildUpdateContextAt(seedSchemeV1{}, Seed{Secret: keyed.seedSecret, UserID: 42, Window: now.Truncate(30 * time.Minute), Query: "问题"}, "zh")
+	want.Settings = keyed
+
+	answers := consultOraclesAt(keyed, 42, "问题", "zh", now)
+	assert.Equal(t, divine(want), answers[0].Text)
+
+	// Without the secret the same query reads differently for some user.
+	differs := false
+	for id := uint64(1); id <= 20 && !differs; id++ {
+		differs = consultOraclesAt(plain, id, "问题", "zh", now)[0].Text != consultOraclesAt(keyed, id, "问题", "zh", now)[0].Text
+	}
+	assert.True(t, differs)
+}
@@ -0,0 +1,288 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/YukariExpress/pgb/internal/stats"
+)
+
+// statsQueries are the queries asked by simulated users, cycled through in
+// order.
+var statsQueries = []string{
+	"明天会下雨吗",
+	"Will it rain tomorrow?",
+	"今天吃什么",
+	"",
+	"火锅还是烧烤",
+	"tea / coffee / juice",
+	"d20",
+	"4d6kh3",
+}
+
+// statsLocales are the locales of simulated users, cycled through in order.
+var statsLocales = []string{"zh", "en"}
+
+// simulation describes a run of simulated queries.
+//
+// Fields:
+//   - Samples: The number of simulated queries.
+//   - Windows: The number of times, half an hour apart, the queries are
+//     spread over.
+//   - Start: The time of the first window.
+type simulation struct {
+	Samples int
+	Windows int
+	Start   time.Time
+}
+
+// oracleStats holds the outcomes an oracle produced in a simulation.
+//
+// Fields:
+//   - Oracle: The oracle.
+//   - Outcomes: The labels of the outcomes, in the order they were first
+//     expected.
+//   - Observed: The number of answers for each outcome.
+//   - Expected: The expected number of answers for each outcome, summed over
+//     the queries the oracle answered.
+//   - Unexpected: The number of answers matching no expected outcome.
+//   - Result: The chi-square test of Observed against Expected.
+//   - Err: Why the test could not be run, or nil.
+type oracleStats struct {
+	Oracle     Oracle
+	Outcomes   []string
+	Observed   []uint64
+	Expected   []float64
+	Unexpected uint64
+	Result     stats.Result
+	Err        error
+
+	index map[string]int
+}
+
+// N returns the number of answers the oracle gave.
+func (o *oracleStats) N() uint64 {
+	n := o.Unexpected
+	for _, c := range o.Observed {
+		n += c
+	}
+
+	return n
+}
+
+// count records an answer to a query.
+//
+// Parameters:
+//   - d: The oracle's distribution.
+//   - query: The query.
+//   - answer: The oracle's answer.
+func (o *oracleStats) count(d Distribution, query, answer string) {
+	for _, e := range d.Expected(query) {
+		i, ok := o.index[e.Label]
+		if !ok {
+			i = len(o.Outcomes)
+			o.index[e.Label] = i
+			o.Outcomes = append(o.Outcomes, e.Label)
+			o.Observed = append(o.Observed, 0)
+			o.Expected = append(o.Expected, 0)
+		}
+
+		o.Expected[i] += e.P
+	}
+
+	if i, ok := o.index[d.Outcome(query, answer)]; ok {
+		o.Observed[i]++
+	} else {
+		o.Unexpected++
+	}
+}
+
+// simulate runs simulated queries through the same pipeline as real ones, so
+// that the counted oracles see the random number generator in the same state
+// as in production. Every simulated query comes from a different user.
+//
+// Parameters:
+//   - s: The settings providing the enabled oracles.
+//   - sim: The parameters of the simulation.
+//
+// Returns:
+//   - The outcome counts and test results of the oracles with a
+//     Distribution, in the order of the enabled oracles.
+func simulate(s *settings, sim simulation) []*oracleStats {
+	var results []*oracleStats
+	byID := make(map[string]*oracleStats)
+
+	for _, o := range s.oracles {
+		if _, ok := o.(Distribution); !ok {
+			continue
+		}
+
+		st := &oracleStats{Oracle: o, index: make(map[string]int)}
+		byID[o.ID()] = st
+		results = append(results, st)
+	}
+
+	windows := max(sim.Windows, 1)
+
+	for i := range sim.Samples {
+		query := statsQueries[i%len(statsQueries)]
+		locale := statsLocales[i%len(statsLocales)]
+		now := sim.Start.Add(time.Duration(i%windows) * 30 * time.Minute)
+
+		for _, a := range consultOraclesAt(s, uint64(i)+1, query, locale, now) {
+			if st, ok := byID[a.Oracle.ID()]; ok {
+				st.count(a.Oracle.(Distribution), query, a.Text)
+			}
+		}
+	}
+
+	for _, st := range results {
+		if st.Unexpected > 0 {
+			st.Err = fmt.Errorf("%d answers match no expected outcome", st.Unexpected)
+			continue
+		}
+
+		st.Result, st.Err = stats.ChiSquare(st.Observed, st.Expected)
+	}
+
+	return results
+}
+
+// writeStats prints an observed-versus-expected table and the chi-square test
+// result of every oracle.
+//
+// Parameters:
+//   - w: The writer to print to.
+//   - results: The simulation results.
+//
+// Returns:
+//   - An error if writing fails.
+func writeStats(w io.Writer, results []*oracleStats) error {
+	for _, st := range results {
+		n := st.N()
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+		fmt.Fprintf(tw, "%s\tobserved\texpected\tobserved %%\texpected %%\t\n", st.Oracle.ID())
+
+		for i, label := range st.Outcomes {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.4f\t%.4f\t\n",
+				outcomeLabel(label), st.Observed[i], st.Expected[i],
+				100*float64(st.Observed[i])/float64(max(n, 1)),
+				100*st.Expected[i]/float64(max(n, 1)))
+		}
+
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		var err error
+		if st.Err != nil {
+			_, err = fmt.Fprintf(w, "n=%d error: %v\n\n", n, st.Err)
+		} else {
+			_, err = fmt.Fprintf(w, "n=%d chi2=%.3f df=%d p=%.4f\n\n", n, st.Result.Statistic, st.Result.DF, st.Result.P)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uncheckedOracles lists the enabled oracles that simulate skips because
+// their outcomes have no known distribution, such as oracles that answer by
+// the clock rather than at random.
+//
+// Parameters:
+//   - s: The settings providing the enabled oracles.
+//
+// Returns:
+//   - The IDs of the oracles without a Distribution, in the configured order.
+func uncheckedOracles(s *settings) []string {
+	var ids []string
+
+	for _, o := range s.oracles {
+		if _, ok := o.(Distribution); !ok {
+			ids = append(ids, o.ID())
+		}
+	}
+
+	return ids
+}
+
+// writeUnchecked prints the oracles the simulation did not check, if any, so
+// that they are not mistaken for oracles that passed.
+//
+// Parameters:
+//   - w: The writer to print to.
+//   - ids: The IDs of the unchecked oracles.
+//
+// Returns:
+//   - An error if writing fails.
+func writeUnchecked(w io.Writer, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "not checked, no known distribution: %s\n", strings.Join(ids, ", "))
+
+	return err
+}
+
+// outcomeLabel makes an empty outcome label visible in the stats table.
+func outcomeLabel(label string) string {
+	if label == "" {
+		return `""`
+	}
+
+	return label
+}
+
+// checkStats fails if an oracle could not be tested or deviates significantly
+// from its expected distribution.
+//
+// Parameters:
+//   - results: The simulation results.
+//   - alpha: The significance level.
+//
+// Returns:
+//   - An error naming every failing oracle, or nil.
+func checkStats(results []*oracleStats, alpha float64) error {
+	var failed []string
+
+	for _, st := range results {
+		switch {
+		case st.Err != nil:
+			failed = append(failed, fmt.Sprintf("%s: %v", st.Oracle.ID(), st.Err))
+		case st.Result.P < alpha:
+			failed = append(failed, fmt.Sprintf("%s: p=%.3g < %g", st.Oracle.ID(), st.Result.P, alpha))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New("outcome distribution check failed: " + strings.Join(failed, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// biasedOracle claims a fair coin but mostly answers heads.
+type biasedOracle struct{}
+
+func (biasedOracle) ID() string                { return "coin" }
+func (biasedOracle) Title(string) string       { return "Coin" }
+func (biasedOracle) Description(string) string { return "Coin" }
+
+func (biasedOracle) Consult(ctx *UpdateContext) string {
+	if ctx.Rand.Uint64()%4 == 0 {
+		return "tails"
+	}
+
+	return "heads"
+}
+
+func (biasedOracle) Expected(string) []Outcome {
+	return []Outcome{{Label: "heads", P: 0.5}, {Label: "tails", P: 0.5}}
+}
+
+func (biasedOracle) Outcome(_, answer string) string { return answer }
+
+// edgeOracle lands its coin on the edge, which it never claims to do.
+type edgeOracle struct{ biasedOracle }
+
+func (edgeOracle) Outcome(string, string) string { return "edge" }
+
+// TestOracleDistributions fails when an oracle's answers deviate
+// significantly from the probabilities it claims. The simulation is
+// deterministic, so the test does not flake.
+func TestOracleDistributions(t *testing.T) {
+	s := testSettings(t, oracles.All()...)
+
+	results := simulate(s, simulation{Samples: 50000, Windows: 48, Start: statsStart})
+
+	for _, st := range results {
+		// Every oracle is asked its share of the queries it accepts.
+		var want uint64
+		for i := range 50000 {
+			if accepts(st.Oracle, statsQueries[i%len(statsQueries)]) {
+				want++
+			}
+		}
+
+		assert.Equal(t, want, st.N(), st.Oracle.ID())
+		assert.NotZero(t, st.N(), st.Oracle.ID())
+	}
+
+	assert.NoError(t, checkStats(results, 0.001))
+}
+
+func TestCheckStatsDetectsBias(t *testing.T) {
+	s := testSettings(t, biasedOracle{}, piaOracle{})
+
+	results := simulate(s, simulation{Samples: 2000, Windows: 4, Start: statsStart})
+	assert.Len(t, results, 2)
+
+	err := checkStats(results, 0.001)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "coin")
+		assert.NotContains(t, err.Error(), "pia")
+	}
+}
+
+func TestCheckStatsUnexpectedOutcome(t *testing.T) {
+	s := testSettings(t, stubOracle{id: "stub", accept: true}, edgeOracle{})
+
+	// The stub has no Distribution and is not reported.
+	results := simulate(s, simulation{Samples: 100, Windows: 1, Start: statsStart})
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, uint64(100), results[0].Unexpected)
+		assert.Error(t, results[0].Err)
+	}
+
+	assert.Error(t, checkStats(results, 0.001))
+}
+
+func TestWriteStats(t *testing.T) {
+	s := testSettings(t, piaOracle{})
+	results := simulate(s, simulation{Samples: 800, Windows: 2, Start: statsStart})
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeStats(&buf, results))
+	assert.Contains(t, buf.String(), "pia")
+	assert.Contains(t, buf.String(), "dog")
+	assert.Contains(t, buf.String(), "n=800 chi2=")
+}
+
+func TestUncheckedOracles(t *testing.T) {
+	s := testSettings(t, piaOracle{}, xiaoliurenOracle{}, divineOracle{}, almanacOracle{})
+	assert.Equal(t, []string{"xiaoliuren", "almanac"}, uncheckedOracles(s))
+	assert.Empty(t, uncheckedOracles(testSettings(t, piaOracle{})))
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeUnchecked(&buf, uncheckedOracles(s)))
+	assert.Equal(t, "not checked, no known distribution: xiaoliuren, almanac\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeUnchecked(&buf, nil))
+	assert.Empty(t, buf.String())
+}
+
+func TestStatsCommand(t *testing.T) {
+	prev := live.Load()
+	t.Cleanup(func() { live.Store(prev) })
+
+	path := writeConfigFile(t, `
+oracles: [pia]
+`)
+	ctx := context.Background()
+
+	assert.NoError(t, runCommand(ctx, []string{"stats", "-config", path, "-n", "1000", "-check"}))
+	assert.Error(t, runCommand(ctx, []string{"stats", "-config", writeConfigFile(t, "oracles: [nonexistent]\n")}))
+
+	// The environment takes precedence over the file, as for serve.
+	t.Setenv("ORACLES", "nonexistent")
+	assert.ErrorContains(t, runCommand(ctx, []string{"stats", "-config", path, "-n", "1000"}), "invalid ORACLES")
+}
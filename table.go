@@ -0,0 +1,121 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Weighted is an outcome of a WeightedTable together with its weight.
+//
+// Fields:
+// - Label: The outcome.
+// - Weight: The relative chance of the outcome. A zero weight never wins.
+type Weighted[T comparable] struct {
+	Label  T      `yaml:"label"`
+	Weight uint32 `yaml:"weight"`
+}
+
+// WeightedTable maps random numbers to outcomes with fixed relative chances.
+// A random value r selects the outcome whose cumulative weight range contains
+// r modulo the total weight, so outcomes are laid out in table order.
+type WeightedTable[T comparable] struct {
+	labels []T
+	bounds []uint64
+	total  uint64
+}
+
+// NewWeightedTable creates a table from outcomes in order.
+//
+// Parameters:
+//   - entries: The outcomes and their weights.
+//
+// Returns:
+//   - A pointer to the new WeightedTable.
+//   - An error if the weights sum to zero or an outcome is listed twice.
+func NewWeightedTable[T comparable](entries []Weighted[T]) (*WeightedTable[T], error) {
+	t := &WeightedTable[T]{
+		labels: make([]T, 0, len(entries)),
+		bounds: make([]uint64, 0, len(entries)),
+	}
+	seen := make(map[T]bool, len(entries))
+
+	for _, e := range entries {
+		if seen[e.Label] {
+			return nil, fmt.Errorf("label %q listed twice", fmt.Sprint(e.Label))
+		}
+
+		seen[e.Label] = true
+		t.total += uint64(e.Weight)
+		t.labels = append(t.labels, e.Label)
+		t.bounds = append(t.bounds, t.total)
+	}
+
+	if t.total == 0 {
+		return nil, errors.New("weights sum to zero")
+	}
+
+	return t, nil
+}
+
+// mustWeightedTable is like NewWeightedTable but panics on an invalid table.
+// It is meant for the built-in tables.
+func mustWeightedTable[T comparable](entries []Weighted[T]) *WeightedTable[T] {
+	t, err := NewWeightedTable(entries)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// Sample selects the outcome for a random value.
+//
+// Parameters:
+//   - r: A random uint64 value.
+//
+// Returns:
+//   - The outcome whose range contains r modulo the total weight.
+func (t *WeightedTable[T]) Sample(r uint64) T {
+	m := r % t.total
+	i := sort.Search(len(t.bounds), func(i int) bool { return m < t.bounds[i] })
+
+	return t.labels[i]
+}
+
+// Total returns the sum of all weights.
+func (t *WeightedTable[T]) Total() uint64 {
+	return t.total
+}
+
+// Entries returns the outcomes and weights of the table in order.
+//
+// Returns:
+//   - A new slice of the table's entries.
+func (t *WeightedTable[T]) Entries() []Weighted[T] {
+	entries := make([]Weighted[T], len(t.labels))
+
+	var prev uint64
+	for i, label := range t.labels {
+		entries[i] = Weighted[T]{Label: label, Weight: uint32(t.bounds[i] - prev)}
+		prev = t.bounds[i]
+	}
+
+	return entries
+}
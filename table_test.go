@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyOmen and legacyMultiplier are the hand-written ranges the built-in
+// tables replaced. The tables must keep producing the same outcomes.
+func legacyOmen(r uint64) string {
+	o := r % 16
+	switch {
+	case 9 <= o:
+		return "吉"
+	case o < 7:
+		return "凶"
+	default:
+		return ""
+	}
+}
+
+func legacyMultiplier(r uint64) string {
+	m := r % 1024
+	switch {
+	case m < 1:
+		return "极小"
+	case m < 11:
+		return "超小"
+	case m < 56:
+		return "特小"
+	case m < 176:
+		return "甚小"
+	case m < 386:
+		return "小"
+	case m < 638:
+		return ""
+	case m < 848:
+		return "大"
+	case m < 968:
+		return "甚大"
+	case m < 1013:
+		return "特大"
+	case m < 1023:
+		return "超大"
+	default:
+		return "极大"
+	}
+}
+
+func TestDefaultTablesMatchLegacy(t *testing.T) {
+	for r := range uint64(2048) {
+		assert.Equal(t, legacyOmen(r), defaultOmens.Sample(r), "omen %d", r)
+		assert.Equal(t, legacyMultiplier(r), defaultMultipliers.Sample(r), "multiplier %d", r)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for range 10000 {
+		r := rng.Uint64()
+		assert.Equal(t, legacyOmen(r), defaultOmens.Sample(r))
+		assert.Equal(t, legacyMultiplier(r), defaultMultipliers.Sample(r))
+	}
+
+	assert.Equal(t, uint64(16), defaultOmens.Total())
+	assert.Equal(t, uint64(1024), defaultMultipliers.Total())
+}
+
+func TestNewWeightedTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []Weighted[string]
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			entries: []Weighted[string]{{Label: "a", Weight: 1}, {Label: "b", Weight: 3}},
+		},
+		{
+			name:    "zero weight entry",
+			entries: []Weighted[string]{{Label: "a", Weight: 0}, {Label: "b", Weight: 1}},
+		},
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+		{
+			name:    "weights sum to zero",
+			entries: []Weighted[string]{{Label: "a"}, {Label: "b"}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate label",
+			entries: []Weighted[string]{{Label: "a", Weight: 1}, {Label: "a", Weight: 2}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := NewWeightedTable(tt.entries)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.entries, table.Entries())
+		})
+	}
+}
+
+func TestWeightedTableSample(t *testing.T) {
+	table := mustWeightedTable([]Weighted[int]{
+		{Label: 1, Weight: 2},
+		{Label: 2, Weight: 0},
+		{Label: 3, Weight: 1},
+	})
+
+	assert.Equal(t, 1, table.Sample(0))
+	assert.Equal(t, 1, table.Sample(1))
+	assert.Equal(t, 3, table.Sample(2))
+	assert.Equal(t, 1, table.Sample(3))
+}
+
+func TestMustWeightedTablePanics(t *testing.T) {
+	assert.Panics(t, func() { mustWeightedTable[string](nil) })
+}
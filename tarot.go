@@ -0,0 +1,339 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// tarotDeckSize is the number of cards in a tarot deck.
+const tarotDeckSize = 78
+
+//go:embed data/tarot.yaml
+var tarotData []byte
+
+// tarotCard is a card of the tarot deck.
+//
+// Fields:
+//   - ID: A stable identifier, such as "major-00" or "cups-14".
+//   - Name: The name of the card.
+//   - Upright: The meaning of the card drawn upright.
+//   - Reversed: The meaning of the card drawn upside down.
+type tarotCard struct {
+	ID       string        `yaml:"id"`
+	Name     localizedText `yaml:"name"`
+	Upright  localizedText `yaml:"upright"`
+	Reversed localizedText `yaml:"reversed"`
+}
+
+// parseTarotDeck parses and validates a tarot deck.
+//
+// Parameters:
+//   - data: The deck as YAML, a list of cards under the "cards" key.
+//
+// Returns:
+//   - The cards of the deck.
+//   - An error if the deck is malformed, does not have exactly 78 cards, or
+//     has a card with a missing text or a duplicate ID or name.
+func parseTarotDeck(data []byte) ([]tarotCard, error) {
+	var deck struct {
+		Cards []tarotCard `yaml:"cards"`
+	}
+
+	if err := yaml.Unmarshal(data, &deck); err != nil {
+		return nil, err
+	}
+
+	if len(deck.Cards) != tarotDeckSize {
+		return nil, fmt.Errorf("tarot deck has %d cards, want %d", len(deck.Cards), tarotDeckSize)
+	}
+
+	seen := make(map[string]bool)
+
+	for i, c := range deck.Cards {
+		if c.ID == "" {
+			return nil, fmt.Errorf("tarot card %d has no ID", i)
+		}
+
+		if !c.Name.isComplete() || !c.Upright.isComplete() || !c.Reversed.isComplete() {
+			return nil, fmt.Errorf("tarot card %q is missing a name or meaning", c.ID)
+		}
+
+		for _, key := range []string{c.ID, "zh:" + c.Name.Zh, "en:" + c.Name.En} {
+			if seen[key] {
+				return nil, fmt.Errorf("tarot card %q is listed twice", key)
+			}
+
+			seen[key] = true
+		}
+	}
+
+	return deck.Cards, nil
+}
+
+// tarotDeck is the embedded Rider-Waite deck.
+var tarotDeck = mustParse(parseTarotDeck, tarotData)
+
+// tarotSpread is a layout of cards, each position answering a part of the
+// question.
+//
+// Fields:
+//   - ID: The identifier of the spread.
+//   - Prefixes: The query prefixes selecting the spread, matched without
+//     regard to case. Longer prefixes come first.
+//   - Name: The name of the spread.
+//   - Positions: The meaning of every position, in the order cards are
+//     drawn.
+type tarotSpread struct {
+	ID        string
+	Prefixes  []string
+	Name      localizedText
+	Positions []localizedText
+}
+
+// tarotSpreads are the spreads offered. The first one is used when the query
+// selects none.
+var tarotSpreads = []tarotSpread{
+	{
+		ID:        "single",
+		Prefixes:  []string{"单张", "single"},
+		Name:      localizedText{Zh: "单张", En: "Single card"},
+		Positions: []localizedText{{Zh: "指引", En: "Guidance"}},
+	},
+	{
+		ID:       "three",
+		Prefixes: []string{"三张", "three"},
+		Name:     localizedText{Zh: "过去·现在·未来", En: "Past, present, future"},
+		Positions: []localizedText{
+			{Zh: "过去", En: "Past"},
+			{Zh: "现在", En: "Present"},
+			{Zh: "未来", En: "Future"},
+		},
+	},
+	{
+		ID:       "celtic",
+		Prefixes: []string{"凯尔特十字", "凯尔特", "celtic cross", "celtic"},
+		Name:     localizedText{Zh: "凯尔特十字", En: "Celtic Cross"},
+		Positions: []localizedText{
+			{Zh: "现状", En: "Present"},
+			{Zh: "挑战", En: "Challenge"},
+			{Zh: "过去", En: "Past"},
+			{Zh: "未来", En: "Future"},
+			{Zh: "目标", En: "Goal"},
+			{Zh: "潜意识", En: "Subconscious"},
+			{Zh: "建议", En: "Advice"},
+			{Zh: "外在影响", En: "External influences"},
+			{Zh: "希望与恐惧", En: "Hopes and fears"},
+			{Zh: "结果", En: "Outcome"},
+		},
+	},
+}
+
+// tarotSpreadOf selects the spread of a query by its prefix. A prefix only
+// counts when it is the whole query or is followed by whitespace or a colon,
+// so that "三张 明天会下雨吗" and "celtic: my career" select spreads but
+// "singleton" does not.
+//
+// Parameters:
+//   - query: The query.
+//
+// Returns:
+//   - The selected spread, or the first one if no prefix matches.
+//   - The query without the prefix and its separator.
+func tarotSpreadOf(query string) (tarotSpread, string) {
+	for _, spread := range tarotSpreads {
+		for _, prefix := range spread.Prefixes {
+			if len(query) < len(prefix) || !strings.EqualFold(query[:len(prefix)], prefix) {
+				continue
+			}
+
+			rest := query[len(prefix):]
+			trimmed := strings.TrimLeft(rest, " \t　:：")
+
+			if rest == "" || trimmed != rest {
+				return spread, trimmed
+			}
+		}
+	}
+
+	return tarotSpreads[0], query
+}
+
+// tarotDraw is a card drawn into a position of a spread.
+type tarotDraw struct {
+	Card     *tarotCard
+	Reversed bool
+}
+
+// drawTarot draws cards without replacement, each upright or reversed with
+// equal chance.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the random number
+//     generator.
+//   - n: The number of cards to draw, at most the size of the deck.
+//
+// Returns:
+//   - The drawn cards in order.
+func drawTarot(ctx *UpdateContext, n int) []tarotDraw {
+	order := make([]int, len(tarotDeck))
+	for i := range order {
+		order[i] = i
+	}
+
+	draws := make([]tarotDraw, n)
+
+	// A partial Fisher-Yates shuffle draws the first n cards.
+	for i := range draws {
+		j := i + ctx.Rand.Intn(len(order)-i)
+		order[i], order[j] = order[j], order[i]
+
+		draws[i] = tarotDraw{Card: &tarotDeck[order[i]], Reversed: ctx.Rand.Intn(2) == 1}
+	}
+
+	return draws
+}
+
+// tarotReversed marks a reversed card in every locale.
+var tarotReversed = localizedText{Zh: "（逆位）", En: " (reversed)"}
+
+// tarotMeaning separates the name of a drawn card from its meaning.
+const tarotMeaning = " — "
+
+// formatTarotDraw formats the name of a drawn card in a locale.
+func formatTarotDraw(d tarotDraw, locale string) string {
+	if d.Reversed {
+		return d.Card.Name.In(locale) + tarotReversed.In(locale)
+	}
+
+	return d.Card.Name.In(locale)
+}
+
+// readTarot lays out the spread selected by the query of an UpdateContext
+// and reads the cards in the user's locale.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the query, locale and
+//     random number generator.
+//
+// Returns:
+//   - A string with the query, the spread and one line for every position
+//     naming the card drawn and its meaning.
+func readTarot(ctx *UpdateContext) string {
+	var b builder
+
+	locale := *ctx.Locale
+	spread, query := tarotSpreadOf(*ctx.Query)
+
+	if locale == "zh" {
+		b.WriteStrings("所求事项: ", query, "\n牌阵: ", spread.Name.Zh)
+	} else {
+		b.WriteStrings("Question: ", query, "\nSpread: ", spread.Name.En)
+	}
+
+	for i, d := range drawTarot(ctx, len(spread.Positions)) {
+		meaning := d.Card.Upright
+		if d.Reversed {
+			meaning = d.Card.Reversed
+		}
+
+		b.WriteStrings("\n", spread.Positions[i].In(locale), ": ",
+			formatTarotDraw(d, locale), tarotMeaning, meaning.In(locale))
+	}
+
+	return b.String()
+}
+
+// tarotOracle draws tarot cards into a spread chosen by the query prefix.
+type tarotOracle struct{}
+
+func (tarotOracle) ID() string { return "tarot" }
+
+func (tarotOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "塔罗"
+	}
+
+	return "Tarot"
+}
+
+func (tarotOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "抽塔罗牌，可用「三张」或「凯尔特十字」开头选择牌阵"
+	}
+
+	return `Draw tarot cards, start with "three" or "celtic" for a spread`
+}
+
+func (tarotOracle) Consult(ctx *UpdateContext) string {
+	return readTarot(ctx)
+}
+
+// tarotOutcome returns the label of the outcome of a drawn card, its ID
+// followed by "/r" if it is reversed.
+func tarotOutcome(c *tarotCard, reversed bool) string {
+	if reversed {
+		return c.ID + "/r"
+	}
+
+	return c.ID
+}
+
+// Expected gives every card in either orientation the same chance of being
+// drawn first, whatever the spread.
+func (tarotOracle) Expected(string) []Outcome {
+	outcomes := make([]Outcome, 0, 2*len(tarotDeck))
+
+	for i := range tarotDeck {
+		for _, reversed := range []bool{false, true} {
+			outcomes = append(outcomes, Outcome{
+				Label: tarotOutcome(&tarotDeck[i], reversed),
+				P:     1 / float64(2*len(tarotDeck)),
+			})
+		}
+	}
+
+	return outcomes
+}
+
+// Outcome reads the first card drawn, which is on the third line of an
+// answer in any locale.
+func (tarotOracle) Outcome(_, answer string) string {
+	lines := strings.SplitN(answer, "\n", 4)
+	if len(lines) < 3 {
+		return ""
+	}
+
+	_, drawn, _ := strings.Cut(lines[2], ": ")
+	drawn, _, _ = strings.Cut(drawn, tarotMeaning)
+
+	for i := range tarotDeck {
+		for _, reversed := range []bool{false, true} {
+			d := tarotDraw{Card: &tarotDeck[i], Reversed: reversed}
+
+			if drawn == formatTarotDraw(d, "zh") || drawn == formatTarotDraw(d, "en") {
+				return tarotOutcome(d.Card, reversed)
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestTarotDeck(t *testing.T) {
+	cards, err := parseTarotDeck(tarotData)
+	require.NoError(t, err)
+	require.Len(t, cards, 78)
+
+	suits := map[string]int{}
+	for _, c := range cards {
+		suit, _, _ := strings.Cut(c.ID, "-")
+		suits[suit]++
+	}
+
+	assert.Equal(t, map[string]int{"major": 22, "wands": 14, "cups": 14, "swords": 14, "pentacles": 14}, suits)
+	assert.Equal(t, "The Fool", cards[0].Name.En)
+	assert.Equal(t, "圣杯国王", cards[49].Name.Zh)
+}
+
+func TestParseTarotDeckErrors(t *testing.T) {
+	valid, err := parseTarotDeck(tarotData)
+	require.NoError(t, err)
+
+	modified := func(f func([]tarotCard) []tarotCard) []byte {
+		data, err := yaml.Marshal(map[string]any{"cards": f(append([]tarotCard(nil), valid...))})
+		require.NoError(t, err)
+
+		return data
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"malformed", []byte("cards: [\n"), "yaml"},
+		{"short", modified(func(c []tarotCard) []tarotCard { return c[:77] }), "has 77 cards"},
+		{"no ID", modified(func(c []tarotCard) []tarotCard { c[3].ID = ""; return c }), "card 3 has no ID"},
+		{"duplicate ID", modified(func(c []tarotCard) []tarotCard { c[1].ID = c[0].ID; return c }), "listed twice"},
+		{"duplicate name", modified(func(c []tarotCard) []tarotCard { c[1].Name.En = c[0].Name.En; return c }), "listed twice"},
+		{"missing meaning", modified(func(c []tarotCard) []tarotCard { c[5].Reversed.Zh = ""; return c }), "missing a name or meaning"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTarotDeck(tt.data)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTarotSpreadOf(t *testing.T) {
+	tests := []struct {
+		query  string
+		spread string
+		rest   string
+	}{
+		{"明天会下雨吗", "single", "明天会下雨吗"},
+		{"", "single", ""},
+		{"三张 明天会下雨吗", "three", "明天会下雨吗"},
+		{"三张：明天会下雨吗", "three", "明天会下雨吗"},
+		{"三张", "three", ""},
+		{"Three: my career", "three", "my career"},
+		{"threefold", "single", "threefold"},
+		{"凯尔特十字 工作", "celtic", "工作"},
+		{"凯尔特 工作", "celtic", "工作"},
+		{"celtic cross my career", "celtic", "my career"},
+		{"Celtic my career", "celtic", "my career"},
+		{"single question", "single", "question"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			spread, rest := tarotSpreadOf(tt.query)
+			assert.Equal(t, tt.spread, spread.ID)
+			assert.Equal(t, tt.rest, rest)
+		})
+	}
+}
+
+func TestDrawTarotWithoutReplacement(t *testing.T) {
+	for seed := range int64(50) {
+		ctx := &UpdateContext{Rand: rand.New(rand.NewSource(seed))}
+		seen := map[string]bool{}
+
+		for _, d := range drawTarot(ctx, tarotDeckSize) {
+			assert.False(t, seen[d.Card.ID], d.Card.ID)
+			seen[d.Card.ID] = true
+		}
+
+		assert.Len(t, seen, tarotDeckSize)
+	}
+}
+
+func TestReadTarot(t *testing.T) {
+	for _, locale := range []string{"zh", "en"} {
+		for _, spread := range tarotSpreads {
+			query := spread.Prefixes[0] + " 问题"
+			ctx := &UpdateContext{Query: &query, Locale: &locale, Rand: rand.New(rand.NewSource(7))}
+
+			answer := readTarot(ctx)
+			lines := strings.Split(answer, "\n")
+
+			require.Len(t, lines, 2+len(spread.Positions), answer)
+			assert.True(t, strings.HasSuffix(lines[0], ": 问题"), answer)
+			assert.Contains(t, lines[1], spread.Name.In(locale))
+
+			for i, pos := range spread.Positions {
+				assert.True(t, strings.HasPrefix(lines[2+i], pos.In(locale)+": "), answer)
+			}
+
+			assert.NotEmpty(t, tarotOracle{}.Outcome(query, answer), answer)
+		}
+	}
+}
+
+func TestTarotOutcome(t *testing.T) {
+	o := tarotOracle{}
+
+	assert.Len(t, o.Expected(""), 156)
+	assert.Equal(t, "major-00/r", o.Outcome("", "所求事项: q\n牌阵: 单张\n指引: 愚者（逆位） — 鲁莽、犹豫、天真"))
+	assert.Equal(t, "cups-14", o.Outcome("", "Question: q\nSpread: Single card\nGuidance: King of Cups — Emotional balance"))
+	assert.Empty(t, o.Outcome("", "Question: q\nSpread: Single card\nGuidance: The Joker — Laughter"))
+	assert.Empty(t, o.Outcome("", "Question: q"))
+}
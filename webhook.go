@@ -0,0 +1,207 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// allowedUpdates lists the update types pgb asks Telegram to deliver: inline
+// queries, and messages for the oracle commands.
+var allowedUpdates = []string{"inline_query", "message"}
+
+// webhookSecretHeader is the header in which Telegram sends the webhook secret
+// token with every update.
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// validateWebhookURL checks that a webhook URL, if set, is an absolute HTTPS
+// URL as required by Telegram.
+//
+// Parameters:
+//   - raw: The configured webhook URL, possibly empty.
+//
+// Returns:
+//   - An error if the URL is set but unusable, or nil otherwise.
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid WEBHOOK_URL: %w", err)
+	}
+
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid WEBHOOK_URL %q: must be an absolute https URL", raw)
+	}
+
+	return nil
+}
+
+// validateWebhookSecret checks that a webhook secret, if set, only contains
+// the 1-256 characters A-Z, a-z, 0-9, "_" and "-" that Telegram accepts.
+//
+// Parameters:
+//   - secret: The configured webhook secret, possibly empty.
+//
+// Returns:
+//   - An error if the secret is set but rejected by Telegram, or nil otherwise.
+func validateWebhookSecret(secret string) error {
+	if len(secret) > 256 {
+		return fmt.Errorf("invalid WEBHOOK_SECRET: longer than 256 characters")
+	}
+
+	for _, c := range secret {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '_' || c == '-':
+		default:
+			return fmt.Errorf("invalid WEBHOOK_SECRET: only A-Z, a-z, 0-9, _ and - are allowed")
+		}
+	}
+
+	return nil
+}
+
+// setWebhook registers the configured webhook URL and secret token with
+// Telegram.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - b: The bot instance to register the webhook for.
+//   - conf: The application configuration providing the webhook settings.
+//
+// Returns:
+//   - An error if Telegram rejected the registration.
+func setWebhook(ctx context.Context, b *bot.Bot, conf *Config) error {
+	ctx, cancel := context.WithTimeout(ctx, conf.Timeout)
+	defer cancel()
+
+	_, err := b.SetWebhook(ctx, &bot.SetWebhookParams{
+		URL:            conf.WebhookURL,
+		AllowedUpdates: allowedUpdates,
+		SecretToken:    conf.WebhookSecret,
+	})
+	if err != nil {
+		return fmt.Errorf("set webhook: %w", err)
+	}
+
+	return nil
+}
+
+// deleteWebhook removes the webhook from Telegram. It runs during shutdown,
+// when the application context is already cancelled, so it uses a fresh
+// context bounded by the given timeout.
+//
+// Parameters:
+//   - b: The bot instance to delete the webhook for.
+//   - timeout: The maximum duration of the request.
+func deleteWebhook(b *bot.Bot, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if _, err := b.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+		slog.Error("delete webhook", slog.Any("error", err))
+	}
+}
+
+// webhookDrift compares the webhook registered with Telegram against the
+// configuration. The secret token is not reported back by Telegram and cannot
+// be compared.
+//
+// Parameters:
+//   - info: The webhook information returned by getWebhookInfo.
+//   - conf: The application configuration providing the webhook settings.
+//
+// Returns:
+//   - A description of the first difference found, or an empty string if the
+//     webhook matches the configuration.
+func webhookDrift(info *models.WebhookInfo, conf *Config) string {
+	if info.URL != conf.WebhookURL {
+		return fmt.Sprintf("url is %q, want %q", info.URL, conf.WebhookURL)
+	}
+
+	// Telegram reports the default update types as an empty list.
+	if len(info.AllowedUpdates) != 0 && !slices.Equal(info.AllowedUpdates, allowedUpdates) {
+		return fmt.Sprintf("allowed updates are %v, want %v", info.AllowedUpdates, allowedUpdates)
+	}
+
+	return ""
+}
+
+// watchWebhook periodically fetches the webhook information from Telegram,
+// logs new delivery errors reported by Telegram and re-registers the webhook when
+// it no longer matches the configuration. It returns when the context is
+// cancelled or immediately if the check interval is zero.
+//
+// Parameters:
+//   - ctx: The context controlling the lifetime of the watcher.
+//   - b: The bot instance owning the webhook.
+//   - conf: The application configuration providing the webhook settings.
+func watchWebhook(ctx context.Context, b *bot.Bot, conf *Config) {
+	if conf.WebhookCheckInterval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(conf.WebhookCheckInterval)
+	defer ticker.Stop()
+
+	var lastErrorDate int
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rctx, cancel := context.WithTimeout(ctx, conf.Timeout)
+		info, err := b.GetWebhookInfo(rctx)
+		cancel()
+		if err != nil {
+			slog.Error("get webhook info", slog.Any("error", err))
+			continue
+		}
+
+		if info.LastErrorMessage != "" && info.LastErrorDate != lastErrorDate {
+			lastErrorDate = info.LastErrorDate
+			slog.Warn("webhook delivery error",
+				slog.Time("at", time.Unix(int64(info.LastErrorDate), 0).UTC()),
+				slog.String("message", info.LastErrorMessage))
+		}
+
+		drift := webhookDrift(info, conf)
+		if drift == "" {
+			continue
+		}
+
+		slog.Warn("webhook drifted, re-registering", slog.String("drift", drift))
+
+		if err := setWebhook(ctx, b, conf); err != nil {
+			slog.Error("repair webhook", slog.Any("error", err))
+		}
+	}
+}
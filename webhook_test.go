@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "empty", url: ""},
+		{name: "https", url: "https://example.com/pgb"},
+		{name: "http", url: "http://example.com/pgb", wantErr: true},
+		{name: "relative", url: "/pgb", wantErr: true},
+		{name: "malformed", url: "https://exa mple.com\x7f", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWebhookURL(tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateWebhookSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{name: "empty", secret: ""},
+		{name: "allowed characters", secret: "Abc_123-xyz"},
+		{name: "space", secret: "abc 123", wantErr: true},
+		{name: "non-ascii", secret: "密钥", wantErr: true},
+		{name: "too long", secret: string(make([]byte, 257)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWebhookSecret(tt.secret)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWebhookDrift(t *testing.T) {
+	conf := &Config{WebhookURL: "https://example.com/pgb"}
+
+	tests := []struct {
+		name    string
+		info    models.WebhookInfo
+		drifted bool
+	}{
+		{
+			name: "matching",
+			info: models.WebhookInfo{URL: conf.WebhookURL, AllowedUpdates: allowedUpdates},
+		},
+		{
+			name: "default allowed updates",
+			info: models.WebhookInfo{URL: conf.WebhookURL},
+		},
+		{
+			name:    "removed",
+			info:    models.WebhookInfo{},
+			drifted: true,
+		},
+		{
+			name:    "different url",
+			info:    models.WebhookInfo{URL: "https://example.org/pgb"},
+			drifted: true,
+		},
+		{
+			name:    "different allowed updates",
+			info:    models.WebhookInfo{URL: conf.WebhookURL, AllowedUpdates: []string{"message"}},
+			drifted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drift := webhookDrift(&tt.info, conf)
+			assert.Equal(t, tt.drifted, drift != "", drift)
+		})
+	}
+}
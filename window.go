@@ -0,0 +1,197 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Calendar units accepted by ParseWindow.
+const (
+	windowDay   = "day"
+	windowWeek  = "week"
+	windowMonth = "month"
+)
+
+// Window is the period during which an oracle gives a user the same answer to
+// the same query. It is either a fixed duration, starting at multiples of the
+// duration since the zero time as time.Time.Truncate counts, and so
+// independent of the timezone, or a calendar day, week or month, which starts
+// at local midnight in the configured timezone. Weeks start on Monday.
+type Window struct {
+	d    time.Duration
+	unit string
+}
+
+// defaultWindow is the window used unless one is configured.
+var defaultWindow = Window{d: 30 * time.Minute}
+
+// ParseWindow parses a window. It accepts a calendar unit ("day", "week" or
+// "month") or a positive duration such as "30m" or "1h".
+//
+// Parameters:
+//   - s: The text to parse.
+//
+// Returns:
+//   - The parsed Window.
+//   - An error if s is neither a calendar unit nor a positive duration.
+func ParseWindow(s string) (Window, error) {
+	switch s {
+	case windowDay, windowWeek, windowMonth:
+		return Window{unit: s}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return Window{}, fmt.Errorf("window %q: want a duration, %q, %q or %q", s, windowDay, windowWeek, windowMonth)
+	}
+
+	if d <= 0 {
+		return Window{}, fmt.Errorf("window %q: must be positive", s)
+	}
+
+	return Window{d: d}, nil
+}
+
+// IsZero reports whether the window is unset.
+func (w Window) IsZero() bool {
+	return w.d == 0 && w.unit == ""
+}
+
+// String returns the window in the form accepted by ParseWindow.
+func (w Window) String() string {
+	if w.unit != "" {
+		return w.unit
+	}
+
+	return w.d.String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (w Window) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (w *Window) UnmarshalText(text []byte) error {
+	parsed, err := ParseWindow(string(text))
+	if err != nil {
+		return err
+	}
+
+	*w = parsed
+
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, so that an invalid window in the
+// configuration file is reported with its line like other decoding errors.
+func (w *Window) UnmarshalYAML(value *yaml.Node) error {
+	var text string
+	if err := value.Decode(&text); err != nil {
+		return err
+	}
+
+	if err := w.UnmarshalText([]byte(text)); err != nil {
+		return fmt.Errorf("yaml: line %d: %w", value.Line, err)
+	}
+
+	return nil
+}
+
+// Start returns the start of the window containing a time.
+//
+// Parameters:
+//   - t: The time.
+//   - loc: The timezone calendar windows are based on.
+//
+// Returns:
+//   - The start of the window. Times in the same window have the same start.
+func (w Window) Start(t time.Time, loc *time.Location) time.Time {
+	if w.unit == "" {
+		return t.Truncate(w.d)
+	}
+
+	year, month, day := t.In(loc).Date()
+
+	switch w.unit {
+	case windowWeek:
+		// Weekday counts from Sunday; shift so that Monday is day 0.
+		day -= (int(t.In(loc).Weekday()) + 6) % 7
+	case windowMonth:
+		day = 1
+	}
+
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// End returns the end of the window containing a time, which is the start of
+// the next window.
+//
+// Parameters:
+//   - t: The time.
+//   - loc: The timezone calendar windows are based on.
+//
+// Returns:
+//   - The end of the window.
+func (w Window) End(t time.Time, loc *time.Location) time.Time {
+	start := w.Start(t, loc)
+
+	switch w.unit {
+	case "":
+		return start.Add(w.d)
+	case windowWeek:
+		return start.AddDate(0, 0, 7)
+	case windowMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Windowed is implemented by oracles whose answers are meant to hold for a
+// particular window, such as a daily almanac. The oracle's window takes
+// precedence over the configured default window but not over a window
+// configured for the oracle itself.
+type Windowed interface {
+	Window() Window
+}
+
+// validateWindows checks that windows are only configured for known oracles.
+//
+// Parameters:
+//   - windows: The configured windows keyed by oracle.
+//
+// Returns:
+//   - An error describing the first invalid window, or nil.
+func validateWindows(windows map[string]Window) error {
+	for oracle, w := range windows {
+		if _, ok := oracles.Get(oracle); !ok {
+			return fmt.Errorf("invalid windows: unknown oracle %q", oracle)
+		}
+
+		if w.IsZero() {
+			return errors.New("invalid windows: empty window for " + oracle)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Window
+		wantErr bool
+	}{
+		{text: "30m", want: Window{d: 30 * time.Minute}},
+		{text: "1h", want: Window{d: time.Hour}},
+		{text: "day", want: Window{unit: windowDay}},
+		{text: "week", want: Window{unit: windowWeek}},
+		{text: "month", want: Window{unit: windowMonth}},
+		{text: "0s", wantErr: true},
+		{text: "-1h", wantErr: true},
+		{text: "fortnight", wantErr: true},
+		{text: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			w, err := ParseWindow(tt.text)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, w)
+
+			text, err := w.MarshalText()
+			assert.NoError(t, err)
+
+			var parsed Window
+			assert.NoError(t, parsed.UnmarshalText(text))
+			assert.Equal(t, w, parsed)
+		})
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("timezone database unavailable:", err)
+	}
+
+	// 2024-05-15 (a Wednesday) 17:10 UTC, 01:10 on 05-16 in Shanghai.
+	now := time.Date(2024, time.May, 15, 17, 10, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		window Window
+		loc    *time.Location
+		want   time.Time
+	}{
+		{name: "30m", window: Window{d: 30 * time.Minute}, loc: shanghai, want: time.Date(2024, time.May, 15, 17, 0, 0, 0, time.UTC)},
+		{name: "1h", window: Window{d: time.Hour}, loc: time.UTC, want: time.Date(2024, time.May, 15, 17, 0, 0, 0, time.UTC)},
+		{name: "6h ignores timezone", window: Window{d: 6 * time.Hour}, loc: shanghai, want: time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)},
+		{name: "day utc", window: Window{unit: windowDay}, loc: time.UTC, want: time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC)},
+		{name: "day shanghai", window: Window{unit: windowDay}, loc: shanghai, want: time.Date(2024, time.May, 16, 0, 0, 0, 0, shanghai)},
+		{name: "week", window: Window{unit: windowWeek}, loc: time.UTC, want: time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC)},
+		{name: "week shanghai", window: Window{unit: windowWeek}, loc: shanghai, want: time.Date(2024, time.May, 13, 0, 0, 0, 0, shanghai)},
+		{name: "month", window: Window{unit: windowMonth}, loc: shanghai, want: time.Date(2024, time.May, 1, 0, 0, 0, 0, shanghai)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.want.Equal(tt.window.Start(now, tt.loc)), "got %v", tt.window.Start(now, tt.loc))
+		})
+	}
+}
+
+func TestWindowStartDayRollsOverAtLocalMidnight(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("timezone database unavailable:", err)
+	}
+
+	day := Window{unit: windowDay}
+	before := time.Date(2024, time.May, 15, 15, 59, 0, 0, time.UTC) // 23:59 local
+	after := time.Date(2024, time.May, 15, 16, 1, 0, 0, time.UTC)   // 00:01 local
+	morning := time.Date(2024, time.May, 16, 0, 30, 0, 0, time.UTC) // 08:30 local
+
+	assert.NotEqual(t, day.Start(before, shanghai).Unix(), day.Start(after, shanghai).Unix())
+	assert.Equal(t, day.Start(after, shanghai).Unix(), day.Start(morning, shanghai).Unix())
+}
+
+func TestWindowEnd(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("timezone database unavailable:", err)
+	}
+
+	// 2024-05-15 (a Wednesday) 17:10 UTC, 01:10 on 05-16 in Shanghai.
+	now := time.Date(2024, time.May, 15, 17, 10, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		window Window
+		loc    *time.Location
+		want   time.Time
+	}{
+		{name: "30m", window: Window{d: 30 * time.Minute}, loc: shanghai, want: time.Date(2024, time.May, 15, 17, 30, 0, 0, time.UTC)},
+		{name: "day utc", window: Window{unit: windowDay}, loc: time.UTC, want: time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "day shanghai", window: Window{unit: windowDay}, loc: shanghai, want: time.Date(2024, time.May, 17, 0, 0, 0, 0, shanghai)},
+		{name: "week", window: Window{unit: windowWeek}, loc: time.UTC, want: time.Date(2024, time.May, 20, 0, 0, 0, 0, time.UTC)},
+		{name: "month", window: Window{unit: windowMonth}, loc: shanghai, want: time.Date(2024, time.June, 1, 0, 0, 0, 0, shanghai)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.window.End(now, tt.loc)
+			assert.True(t, tt.want.Equal(got), "got %v", got)
+			assert.Equal(t, got.Unix(), tt.window.Start(got, tt.loc).Unix())
+		})
+	}
+}
+
+func TestValidateWindows(t *testing.T) {
+	assert.NoError(t, validateWindows(nil))
+	assert.NoError(t, validateWindows(map[string]Window{"divine": {unit: windowDay}}))
+	assert.Error(t, validateWindows(map[string]Window{"nonexistent": {unit: windowDay}}))
+	assert.Error(t, validateWindows(map[string]Window{"divine": {}}))
+}
+
+// dailyOracle is a stub oracle with a built-in daily window.
+type dailyOracle struct{ stubOracle }
+
+func (dailyOracle) Window() Window { return Window{unit: windowDay} }
+
+func TestSettingsWindowOf(t *testing.T) {
+	s, err := newSettings(&Config{
+		Window:  Window{d: time.Hour},
+		Windows: map[string]Window{"pia": {unit: windowWeek}},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, Window{d: time.Hour}, s.windowOf(divineOracle{}))
+	assert.Equal(t, Window{unit: windowWeek}, s.windowOf(piaOracle{}))
+	assert.Equal(t, Window{unit: windowDay}, s.windowOf(dailyOracle{stubOracle{id: "daily"}}))
+
+	s, err = newSettings(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultWindow, s.windowOf(divineOracle{}))
+	assert.Equal(t, time.UTC, s.location)
+
+	_, err = newSettings(&Config{Timezone: "Mars/Olympus_Mons"})
+	assert.Error(t, err)
+}
+
+func TestConsultOraclesAtDefaultWindow(t *testing.T) {
+	// With the same window divine and pia share one context, as they always
+	// have: divine draws first and pia continues from where it stopped.
+	s := testSettings(t, divineOracle{}, piaOracle{})
+	now := time.Date(2024, time.May, 15, 17, 10, 0, 0, time.UTC)
+
+	rctx := buildUpdateContextAt(seedSchemeV1{}, Seed{UserID: 42, Window: now.Truncate(30 * time.Minute), Query: "问题"}, "zh")
+	rctx.Settings = s
+	want := []string{divine(rctx), pia(rctx)}
+
+	answers := consultOraclesAt(s, 42, "问题", "zh", now)
+	assert.Equal(t, want, []string{answers[0].Text, answers[1].Text})
+}
+
+func TestConsultOraclesAtSeparateWindows(t *testing.T) {
+	s := testSettings(t, divineOracle{}, piaOracle{})
+	s.windows = map[string]Window{"divine": {unit: windowDay}}
+
+	morning := time.Date(2024, time.May, 15, 8, 10, 0, 0, time.UTC)
+	evening := time.Date(2024, time.May, 15, 20, 10, 0, 0, time.UTC)
+
+	a := consultOraclesAt(s, 42, "问题", "zh", morning)
+	b := consultOraclesAt(s, 42, "问题", "zh", evening)
+
+	// The daily divination holds all day.
+	assert.Equal(t, a[0].Text, b[0].Text)
+
+	// Pia has a context of its own for its 30 minute window, which still
+	// starts with a divination.
+	rctx := buildUpdateContextAt(seedSchemeV1{}, Seed{UserID: 42, Window: morning.Truncate(30 * time.Minute), Query: "问题"}, "zh")
+	rctx.Settings = s
+	drawDivination(rctx)
+	assert.Equal(t, pia(rctx), a[1].Text)
+}
+
+func TestConsultOraclesAtStableWithinWindow(t *testing.T) {
+	// Tarot's answer holds all day, whether or not the 30 minute window of
+	// divine and pia happens to start at midnight too.
+	s := testSettings(t, divineOracle{}, piaOracle{}, tarotOracle{})
+	s.windows = map[string]Window{"tarot": {unit: windowDay}}
+
+	first := time.Date(2024, time.May, 15, 0, 10, 0, 0, time.UTC)
+	second := time.Date(2024, time.May, 15, 0, 40, 0, 0, time.UTC)
+
+	a := consultOraclesAt(s, 42, "问题", "zh", first)
+	b := consultOraclesAt(s, 42, "问题", "zh", second)
+
+	assert.Equal(t, a[2].Text, b[2].Text)
+}
@@ -0,0 +1,141 @@
+// PGB: Pythia Gata Bot
+// Copyright (C) 2019-2024  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"github.com/YukariExpress/pgb/internal/lunar"
+)
+
+// xiaoliurenPalace is one of the six palaces of 小六壬.
+//
+// Fields:
+//   - Name: The name of the palace.
+//   - Omen: Whether the palace is auspicious, "吉" or "凶".
+//   - Verse: The traditional verse reading the palace.
+type xiaoliurenPalace struct {
+	Name  string
+	Omen  string
+	Verse string
+}
+
+// xiaoliurenPalaces are the six palaces in the order they are counted.
+var xiaoliurenPalaces = [6]xiaoliurenPalace{
+	{"大安", "吉", "大安事事昌，求财在坤方，失物去不远，宅舍保安康。行人身未动，病者主无妨，将军回田野，仔细更推详。"},
+	{"留连", "凶", "留连事难成，求谋日未明，官事只宜缓，去者未回程。失物南方见，急讨方称心，更须防口舌，人口且平平。"},
+	{"速喜", "吉", "速喜喜来临，求财向南行，失物申未午，逢人路上寻。官事有福德，病者无祸侵，田宅六畜吉，行人有信音。"},
+	{"赤口", "凶", "赤口主口舌，官非切要防，失物速速讨，行人有惊慌。六畜多作怪，病者出西方，更须防咀咒，诚恐染瘟殃。"},
+	{"小吉", "吉", "小吉最吉昌，路上好商量，阴人来报喜，失物在坤方。行人即便至，交关甚是强，凡事皆和合，病者叩穹苍。"},
+	{"空亡", "凶", "空亡事不祥，阴人多乖张，求财无利益，行人有灾殃。失物寻不见，官事有刑伤，病人逢暗鬼，解禳保安康。"},
+}
+
+// shichenNames are the twelve double hours of the day, starting with 子时 at
+// 23:00.
+var shichenNames = [12]string{"子", "丑", "寅", "卯", "辰", "巳", "午", "未", "申", "酉", "戌", "亥"}
+
+// shichen returns the double hour of a time of day.
+//
+// Parameters:
+//   - hour: The hour, from 0 to 23.
+//
+// Returns:
+//   - The index of the double hour in shichenNames.
+func shichen(hour int) int {
+	return (hour + 1) / 2 % 12
+}
+
+// xiaoliurenPalaceOf counts the palace of a lunar month, day and double hour.
+// Counting starts at 大安 for the first month, goes on from the palace of the
+// month for the day, and from the palace of the day for the double hour.
+//
+// Parameters:
+//   - month: The lunar month, from 1 to 12. A leap month counts as its
+//     number.
+//   - day: The lunar day, from 1 to 30.
+//   - hour: The index of the double hour, from 0 for 子时 to 11 for 亥时.
+//
+// Returns:
+//   - The palace.
+func xiaoliurenPalaceOf(month, day, hour int) xiaoliurenPalace {
+	return xiaoliurenPalaces[(month+day+hour-2)%6]
+}
+
+// divineXiaoliuren casts 小六壬 for the time of an UpdateContext. The day
+// changes at the start of 子时 at 23:00, as is traditional.
+//
+// Parameters:
+//   - ctx: A pointer to an UpdateContext containing the query and the time
+//     of the query.
+//
+// Returns:
+//   - A string with the query, the lunar date and double hour, the palace
+//     and its verse, or a note if the date is outside the lunar calendar.
+func divineXiaoliuren(ctx *UpdateContext) string {
+	var b builder
+
+	hour := shichen(ctx.Time.Hour())
+
+	day := ctx.Time
+	if ctx.Time.Hour() == 23 {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	b.WriteStrings("所求事项: ", *ctx.Query)
+
+	date, err := lunar.FromSolar(day)
+	if err != nil {
+		b.WriteStrings("\n", day.Format(time.DateOnly), " 不在农历范围内")
+
+		return b.String()
+	}
+
+	palace := xiaoliurenPalaceOf(date.Month, date.Day, hour)
+
+	b.WriteStrings("\n农历: ", date.String(), " ", shichenNames[hour], "时",
+		"\n小六壬: ", palace.Name, "（", palace.Omen, "）",
+		"\n", palace.Verse)
+
+	return b.String()
+}
+
+// xiaoliurenOracle reads 小六壬 from the lunar month, day and double hour of
+// the query in the configured timezone. Everyone asking at the same time gets
+// the same palace.
+type xiaoliurenOracle struct{}
+
+func (xiaoliurenOracle) ID() string { return "xiaoliuren" }
+
+func (xiaoliurenOracle) Title(locale string) string {
+	if locale == "zh" {
+		return "小六壬"
+	}
+
+	return "Xiao Liu Ren"
+}
+
+func (xiaoliurenOracle) Description(locale string) string {
+	if locale == "zh" {
+		return "以农历月日与时辰起课"
+	}
+
+	return "Divine by the lunar date and hour"
+}
+
+func (xiaoliurenOracle) Consult(ctx *UpdateContext) string {
+	return divineXiaoliuren(ctx)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShichen(t *testing.T) {
+	tests := []struct {
+		hour int
+		want string
+	}{
+		{23, "子"},
+		{0, "子"},
+		{1, "丑"},
+		{2, "丑"},
+		{11, "午"},
+		{12, "午"},
+		{13, "未"},
+		{21, "亥"},
+		{22, "亥"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, shichenNames[shichen(tt.hour)], tt.hour)
+	}
+}
+
+func TestXiaoliurenPalaceOf(t *testing.T) {
+	tests := []struct {
+		month, day, hour int
+		want             string
+	}{
+		{1, 1, 0, "大安"},
+		{1, 1, 1, "留连"},
+		{1, 2, 0, "留连"},
+		{2, 1, 0, "留连"},
+		{3, 5, 4, "小吉"},
+		{6, 1, 0, "空亡"},
+		{7, 1, 0, "大安"},
+		{12, 30, 11, "赤口"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, xiaoliurenPalaceOf(tt.month, tt.day, tt.hour).Name, "%d/%d/%d", tt.month, tt.day, tt.hour)
+	}
+}
+
+func TestDivineXiaoliuren(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{
+			name: "noon",
+			time: time.Date(2024, time.February, 10, 12, 30, 0, 0, shanghai),
+			want: "农历: 甲辰年正月初一 午时\n小六壬: 大安（吉）",
+		},
+		{
+			name: "late zi hour starts the next day",
+			time: time.Date(2024, time.February, 9, 23, 30, 0, 0, shanghai),
+			want: "农历: 甲辰年正月初一 子时\n小六壬: 大安（吉）",
+		},
+		{
+			name: "leap month",
+			time: time.Date(2025, time.July, 25, 8, 0, 0, 0, shanghai),
+			want: "农历: 乙巳年闰六月初一 辰时\n小六壬: 赤口（凶）",
+		},
+		{
+			name: "out of range",
+			time: time.Date(2101, time.March, 1, 8, 0, 0, 0, shanghai),
+			want: "2101-03-01 不在农历范围内",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := "问题"
+			answer := divineXiaoliuren(&UpdateContext{Query: &query, Time: tt.time})
+
+			assert.True(t, strings.HasPrefix(answer, "所求事项: 问题\n"), answer)
+			assert.Contains(t, answer, tt.want)
+		})
+	}
+}
+
+func TestConsultXiaoliurenInTimezone(t *testing.T) {
+	s, err := newSettings(&Config{Timezone: "Asia/Shanghai"})
+	require.NoError(t, err)
+
+	s.oracles = []Oracle{xiaoliurenOracle{}}
+
+	// 2024-02-09 16:30 UTC is 00:30 on the Spring Festival in Shanghai.
+	answers := consultOraclesAt(s, 42, "问题", "zh", time.Date(2024, time.February, 9, 16, 30, 0, 0, time.UTC))
+	require.Len(t, answers, 1)
+	assert.Contains(t, answers[0].Text, "农历: 甲辰年正月初一 子时")
+}